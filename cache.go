@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// cache maps generated files to the hashes of their inputs. It is loaded
+// from and saved to the file of the -cache flag.
+var cache struct {
+	sync.Mutex
+	loaded  bool
+	entries map[string]string
+}
+
+// useCache reports whether files are generated with the -cache flag.
+func useCache() bool {
+	return cacheFile != "" && !toStdout && !dryRun && !check && !clean
+}
+
+// cached reports whether filename has been generated from the inputs of
+// hash and still exists.
+func cached(filename, hash string) (bool, error) {
+	cache.Lock()
+	defer cache.Unlock()
+	if !cache.loaded {
+		cache.entries = make(map[string]string)
+		src, err := ioutil.ReadFile(cacheFile)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return false, err
+		default:
+			if err := json.Unmarshal(src, &cache.entries); err != nil {
+				return false, fmt.Errorf("invalid -cache %s: %v", cacheFile, err)
+			}
+		}
+		cache.loaded = true
+	}
+	if cache.entries[filename] != hash {
+		return false, nil
+	}
+	if _, err := os.Stat(filename); err != nil {
+		return false, nil
+	}
+	logf("unchanged %s by -cache", filename)
+	count(&totals.unchanged)
+	return true, nil
+}
+
+// storeCache records that filename has been generated from the inputs of
+// hash, and saves the cache.
+func storeCache(filename, hash string) error {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.entries[filename] = hash
+	src, err := json.MarshalIndent(cache.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(cacheFile, append(src, '\n'), 0644)
+}
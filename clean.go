@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/daisuzu/encjsongen/generator"
+)
+
+// orphanedError is returned by -check -clean for a generated file which
+// would be removed.
+type orphanedError struct {
+	filename string
+}
+
+func (e *orphanedError) Error() string {
+	return e.filename + " is generated from no type"
+}
+
+// orphans returns the Go files in dir generated by encjsongen for the
+// package name but not by the latest run, whose files are generated.
+func orphans(dir, name string, generated map[string]bool) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, filename := range matches {
+		if generated[filename] {
+			continue
+		}
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Contains(src, []byte(generator.GeneratedMarker)) {
+			continue
+		}
+		// The generated files of the other package in dir, such as the
+		// external tests, are not its orphans.
+		f, err := parser.ParseFile(token.NewFileSet(), filename, src, parser.PackageClauseOnly)
+		if err != nil || f.Name.Name != name {
+			continue
+		}
+		files = append(files, filename)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// remove deletes filename, or reports its removal with -dry-run or -check.
+func remove(filename string) error {
+	if toStdout {
+		return nil
+	}
+	if dryRun || check {
+		if dryRun {
+			old, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return err
+			}
+			stdoutMu.Lock()
+			_, err = os.Stdout.Write(unifiedDiff(filename, old, nil))
+			stdoutMu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+		if check {
+			return &orphanedError{filename}
+		}
+		return nil
+	}
+	if err := os.Remove(filename); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	logf("removed %s", filename)
+	count(&totals.removed)
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/daisuzu/encjsongen/generator"
+)
+
+// configs caches the Configs by filename.
+var configs struct {
+	sync.Mutex
+	byFile map[string]*generator.Config
+}
+
+// packageGenerator returns the generator of pkg, with the Config of the
+// -config flag, or else of encjsongen.yaml at its module root if any.
+func packageGenerator(pkg *generator.Package) (*generator.Generator, error) {
+	if configFile != "" {
+		cfg, err := loadConfig(configFile)
+		if err != nil {
+			return nil, err
+		}
+		return newGenerator(cfg)
+	}
+	if len(pkg.Syntax) == 0 {
+		return newGenerator(nil)
+	}
+	dir := pkg.FileDir(pkg.Syntax[0].Pos())
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return newGenerator(nil)
+		}
+		dir = parent
+	}
+	filename := filepath.Join(dir, generator.ConfigFile)
+	if _, err := os.Stat(filename); err != nil {
+		return newGenerator(nil)
+	}
+	cfg, err := loadConfig(filename)
+	if err != nil {
+		return nil, err
+	}
+	return newGenerator(cfg)
+}
+
+// loadConfig returns the Config of filename, which is read once.
+func loadConfig(filename string) (*generator.Config, error) {
+	configs.Lock()
+	defer configs.Unlock()
+	if cfg, ok := configs.byFile[filename]; ok {
+		return cfg, nil
+	}
+	cfg, err := generator.LoadConfig(filename)
+	if err != nil {
+		return nil, err
+	}
+	if configs.byFile == nil {
+		configs.byFile = make(map[string]*generator.Config)
+	}
+	configs.byFile[filename] = cfg
+	return cfg, nil
+}
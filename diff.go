@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around each hunk.
+const diffContext = 3
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// unifiedDiff returns the unified diff from old to cur of the file name,
+// or nil if they are identical. old is nil if the file does not exist.
+func unifiedDiff(name string, old, cur []byte) []byte {
+	if old != nil && bytes.Equal(old, cur) {
+		return nil
+	}
+	ops := diffLines(splitLines(old), splitLines(cur))
+
+	// Line numbers before each op.
+	ai, bi := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for k, o := range ops {
+		ai[k+1], bi[k+1] = ai[k], bi[k]
+		if o.kind != '+' {
+			ai[k+1]++
+		}
+		if o.kind != '-' {
+			bi[k+1]++
+		}
+	}
+
+	b := new(bytes.Buffer)
+	from := name
+	if old == nil {
+		from = "/dev/null"
+	}
+	fmt.Fprintf(b, "--- %s\n+++ %s\n", from, name)
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		start := k - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := k
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			j := end
+			for j < len(ops) && ops[j].kind == ' ' {
+				j++
+			}
+			if j == len(ops) || j-end > 2*diffContext {
+				break
+			}
+			end = j
+		}
+		stop := end + diffContext
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		fmt.Fprintf(b, "@@ -%s +%s @@\n", hunkRange(ai[start], ai[stop]-ai[start]), hunkRange(bi[start], bi[stop]-bi[start]))
+		for _, o := range ops[start:stop] {
+			b.WriteByte(o.kind)
+			b.WriteString(o.text)
+			if !strings.HasSuffix(o.text, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		k = stop
+	}
+	return b.Bytes()
+}
+
+func hunkRange(start, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+func splitLines(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the edit script from a to b based on their longest
+// common subsequence.
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
@@ -0,0 +1,511 @@
+package direct
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxDepth limits the nesting of values skipped by Lexer, as encoding/json
+// does.
+const maxDepth = 10000
+
+// Lexer reads JSON values token by token. It keeps the first error, after
+// which the reads return zero values.
+type Lexer struct {
+	data  []byte
+	pos   int
+	err   error
+	comma bool // a comma is read after the last member or element
+}
+
+// NewLexer returns a Lexer reading data.
+func NewLexer(data []byte) Lexer {
+	return Lexer{data: data}
+}
+
+// Err returns the first error.
+func (l *Lexer) Err() error {
+	return l.err
+}
+
+// AddError keeps err unless there is an error already.
+func (l *Lexer) AddError(err error) {
+	if l.err == nil && err != nil {
+		l.err = err
+	}
+}
+
+func (l *Lexer) errorf(format string, args ...interface{}) {
+	l.AddError(fmt.Errorf("json: %s at offset %d", fmt.Sprintf(format, args...), l.pos))
+}
+
+// next skips whitespace and returns the next byte, or 0 at the end.
+func (l *Lexer) next() byte {
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; c {
+		case ' ', '\t', '\n', '\r':
+			l.pos++
+		default:
+			return c
+		}
+	}
+	return 0
+}
+
+// expect reports an error unless the next value is of want.
+func (l *Lexer) expect(want string) {
+	c := l.next()
+	if l.err != nil {
+		return
+	}
+	if c == 0 {
+		l.errorf("unexpected end of JSON input")
+		return
+	}
+	var got string
+	switch {
+	case c == '"':
+		got = "string"
+	case c == '{':
+		got = "object"
+	case c == '[':
+		got = "array"
+	case c == 't' || c == 'f':
+		got = "bool"
+	case c == 'n':
+		got = "null"
+	case c == '-' || '0' <= c && c <= '9':
+		got = "number"
+	default:
+		l.errorf("invalid character %q looking for beginning of value", c)
+		return
+	}
+	l.errorf("cannot unmarshal %s into %s", got, want)
+}
+
+// Null reads null if it is next, and reports whether it did.
+func (l *Lexer) Null() bool {
+	if l.err != nil || l.next() != 'n' {
+		return false
+	}
+	l.literal("null")
+	return l.err == nil
+}
+
+// Delim reads c, one of '{', '}', '[' and ']'.
+func (l *Lexer) Delim(c byte) {
+	if l.err != nil {
+		return
+	}
+	if got := l.next(); got != c {
+		switch {
+		case c == '{':
+			l.expect("object")
+		case c == '[':
+			l.expect("array")
+		case got == 0:
+			l.errorf("unexpected end of JSON input")
+		default:
+			l.errorf("invalid character %q, expecting %q", got, c)
+		}
+		return
+	}
+	l.pos++
+	l.comma = false
+}
+
+// More reports whether a member or an element follows in the current
+// object or array.
+func (l *Lexer) More() bool {
+	if l.err != nil {
+		return false
+	}
+	if c := l.next(); c == '}' || c == ']' || c == 0 {
+		if l.comma {
+			l.errorf("invalid character %q after comma", c)
+		}
+		return false
+	}
+	l.comma = false
+	return true
+}
+
+// Comma reads the comma after a member or an element unless the object
+// or the array ends.
+func (l *Lexer) Comma() {
+	if l.err != nil {
+		return
+	}
+	switch c := l.next(); c {
+	case ',':
+		l.pos++
+		l.comma = true
+	case '}', ']':
+	case 0:
+		l.errorf("unexpected end of JSON input")
+	default:
+		l.errorf("invalid character %q after value", c)
+	}
+}
+
+// Key reads the name of a member and the colon after it. The name may
+// refer to the data of l.
+func (l *Lexer) Key() []byte {
+	key := l.str()
+	if l.err != nil {
+		return nil
+	}
+	if c := l.next(); c != ':' {
+		l.errorf("invalid character %q after object key", c)
+		return nil
+	}
+	l.pos++
+	return key
+}
+
+// Str reads a string.
+func (l *Lexer) Str() string {
+	return string(l.str())
+}
+
+// str reads a string, referring to the data of l unless it has escapes.
+func (l *Lexer) str() []byte {
+	if l.err != nil {
+		return nil
+	}
+	if l.next() != '"' {
+		l.expect("string")
+		return nil
+	}
+	start := l.pos + 1
+	for i := start; i < len(l.data); i++ {
+		switch c := l.data[i]; {
+		case c == '"':
+			l.pos = i + 1
+			return l.data[start:i]
+		case c == '\\' || c < 0x20 || c >= utf8.RuneSelf:
+			return l.unquote(start, i)
+		}
+	}
+	l.pos = len(l.data)
+	l.errorf("unexpected end of JSON input")
+	return nil
+}
+
+// unquote reads the rest of a string from i, which started at start.
+func (l *Lexer) unquote(start, i int) []byte {
+	b := make([]byte, 0, i-start+8)
+	b = append(b, l.data[start:i]...)
+	for i < len(l.data) {
+		c := l.data[i]
+		switch {
+		case c == '"':
+			l.pos = i + 1
+			return b
+		case c == '\\':
+			if i+1 >= len(l.data) {
+				i++
+				break
+			}
+			switch e := l.data[i+1]; e {
+			case '"', '\\', '/':
+				b = append(b, e)
+			case 'b':
+				b = append(b, '\b')
+			case 'f':
+				b = append(b, '\f')
+			case 'n':
+				b = append(b, '\n')
+			case 'r':
+				b = append(b, '\r')
+			case 't':
+				b = append(b, '\t')
+			case 'u':
+				r, ok := hex4(l.data[i+2:])
+				if !ok {
+					l.pos = i
+					l.errorf("invalid escape in string")
+					return nil
+				}
+				i += 6
+				if utf16.IsSurrogate(r) {
+					if i+1 < len(l.data) && l.data[i] == '\\' && l.data[i+1] == 'u' {
+						r2, ok := hex4(l.data[i+2:])
+						if dec := utf16.DecodeRune(r, r2); ok && dec != utf8.RuneError {
+							i += 6
+							b = utf8.AppendRune(b, dec)
+							continue
+						}
+					}
+					r = utf8.RuneError
+				}
+				b = utf8.AppendRune(b, r)
+				continue
+			default:
+				l.pos = i
+				l.errorf("invalid escape in string")
+				return nil
+			}
+			i += 2
+		case c < 0x20:
+			l.pos = i
+			l.errorf("invalid character %q in string literal", c)
+			return nil
+		case c < utf8.RuneSelf:
+			b = append(b, c)
+			i++
+		default:
+			r, size := utf8.DecodeRune(l.data[i:])
+			b = utf8.AppendRune(b, r)
+			i += size
+		}
+	}
+	l.pos = len(l.data)
+	l.errorf("unexpected end of JSON input")
+	return nil
+}
+
+// hex4 returns the rune of the 4 hexadecimal digits at the head of b.
+func hex4(b []byte) (rune, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	var r rune
+	for _, c := range b[:4] {
+		switch {
+		case '0' <= c && c <= '9':
+			c -= '0'
+		case 'a' <= c && c <= 'f':
+			c = c - 'a' + 10
+		case 'A' <= c && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(c)
+	}
+	return r, true
+}
+
+// Bool reads a boolean.
+func (l *Lexer) Bool() bool {
+	if l.err != nil {
+		return false
+	}
+	switch l.next() {
+	case 't':
+		l.literal("true")
+		return l.err == nil
+	case 'f':
+		l.literal("false")
+		return false
+	}
+	l.expect("bool")
+	return false
+}
+
+func (l *Lexer) literal(s string) {
+	if len(l.data)-l.pos < len(s) || string(l.data[l.pos:l.pos+len(s)]) != s {
+		l.errorf("invalid literal, expecting %s", s)
+		return
+	}
+	l.pos += len(s)
+}
+
+// number reads a number and returns its text.
+func (l *Lexer) number() []byte {
+	c := l.next()
+	if c != '-' && (c < '0' || '9' < c) {
+		l.expect("number")
+		return nil
+	}
+	start, i := l.pos, l.pos
+	digits := func() bool {
+		n := i
+		for i < len(l.data) && '0' <= l.data[i] && l.data[i] <= '9' {
+			i++
+		}
+		return i > n
+	}
+	if l.data[i] == '-' {
+		i++
+	}
+	switch {
+	case i < len(l.data) && l.data[i] == '0':
+		i++
+	case !digits():
+		l.pos = i
+		l.errorf("invalid number")
+		return nil
+	}
+	if i < len(l.data) && l.data[i] == '.' {
+		i++
+		if !digits() {
+			l.pos = i
+			l.errorf("invalid number")
+			return nil
+		}
+	}
+	if i < len(l.data) && (l.data[i] == 'e' || l.data[i] == 'E') {
+		i++
+		if i < len(l.data) && (l.data[i] == '+' || l.data[i] == '-') {
+			i++
+		}
+		if !digits() {
+			l.pos = i
+			l.errorf("invalid number")
+			return nil
+		}
+	}
+	l.pos = i
+	return l.data[start:i]
+}
+
+// Int reads an integer of the bit size, 0 for int.
+func (l *Lexer) Int(bits int) int64 {
+	start := l.pos
+	num := l.number()
+	if l.err != nil {
+		return 0
+	}
+	v, err := strconv.ParseInt(string(num), 10, bitSize(bits))
+	if err != nil {
+		l.pos = start
+		l.errorf("cannot unmarshal number %s into int%d", num, bitSize(bits))
+		return 0
+	}
+	return v
+}
+
+// Uint reads an unsigned integer of the bit size, 0 for uint.
+func (l *Lexer) Uint(bits int) uint64 {
+	start := l.pos
+	num := l.number()
+	if l.err != nil {
+		return 0
+	}
+	v, err := strconv.ParseUint(string(num), 10, bitSize(bits))
+	if err != nil {
+		l.pos = start
+		l.errorf("cannot unmarshal number %s into uint%d", num, bitSize(bits))
+		return 0
+	}
+	return v
+}
+
+func bitSize(bits int) int {
+	if bits == 0 {
+		return strconv.IntSize
+	}
+	return bits
+}
+
+// Float reads a floating-point number of the bit size.
+func (l *Lexer) Float(bits int) float64 {
+	start := l.pos
+	num := l.number()
+	if l.err != nil {
+		return 0
+	}
+	v, err := strconv.ParseFloat(string(num), bits)
+	if err != nil {
+		l.pos = start
+		l.errorf("cannot unmarshal number %s into float%d", num, bits)
+		return 0
+	}
+	return v
+}
+
+// Raw reads a value and returns its text, e.g. to pass to a unmarshaler.
+func (l *Lexer) Raw() []byte {
+	if l.err != nil {
+		return nil
+	}
+	l.next()
+	start := l.pos
+	l.Skip()
+	if l.err != nil {
+		return nil
+	}
+	return l.data[start:l.pos]
+}
+
+// Peek returns the text of the next value without reading it.
+func (l *Lexer) Peek() []byte {
+	pos := l.pos
+	raw := l.Raw()
+	l.pos = pos
+	return raw
+}
+
+// Skip reads a value and discards it.
+func (l *Lexer) Skip() {
+	l.skip(0)
+}
+
+func (l *Lexer) skip(depth int) {
+	if l.err != nil {
+		return
+	}
+	c := l.next()
+	if (c == '{' || c == '[') && depth >= maxDepth {
+		l.AddError(errors.New("json: exceeded max depth"))
+		return
+	}
+	switch {
+	case c == '{':
+		l.Delim('{')
+		for l.More() {
+			l.Key()
+			l.skip(depth + 1)
+			l.Comma()
+		}
+		l.Delim('}')
+	case c == '[':
+		l.Delim('[')
+		for l.More() {
+			l.skip(depth + 1)
+			l.Comma()
+		}
+		l.Delim(']')
+	case c == '"':
+		l.str()
+	case c == 't' || c == 'f':
+		l.Bool()
+	case c == 'n':
+		l.literal("null")
+	default:
+		l.number()
+	}
+}
+
+// End reports an error unless only whitespace remains.
+func (l *Lexer) End() {
+	if l.err != nil {
+		return
+	}
+	if c := l.next(); l.pos < len(l.data) {
+		l.errorf("invalid character %q after top-level value", c)
+	}
+}
+
+// Fold returns the first of names equal to key, or else equal under
+// case-folding, in order to match keys as encoding/json does. "" is
+// returned if none is.
+func Fold(key []byte, names ...string) string {
+	for _, name := range names {
+		if string(key) == name {
+			return name
+		}
+	}
+	for _, name := range names {
+		if bytes.EqualFold(key, []byte(name)) {
+			return name
+		}
+	}
+	return ""
+}
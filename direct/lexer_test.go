@@ -0,0 +1,135 @@
+package direct
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+// The tests compare the results of Lexer with those of encoding/json.
+
+func TestStr(t *testing.T) {
+	for _, in := range []string{
+		`"a"`,
+		`"a\"b\\c\/d"`,
+		`"\b\f\n\r\t"`,
+		`"\u00e9\u4e16"`,
+		"\"\u00e9\u4e16\"",
+		`"\ud83d\ude00"`,
+		`"\ud83d"`,
+		`"\ud83dx"`,
+		`"\ud83dA"`,
+		`"\ude00\ud83d"`,
+		"\"\xff\"",
+		`"\x"`,
+		`"\u12"`,
+		"\"a\nb\"",
+		`"a`,
+		`1`,
+	} {
+		l := NewLexer([]byte(in))
+		got := l.Str()
+		l.End()
+		var want string
+		err := json.Unmarshal([]byte(in), &want)
+		if got != want || (l.Err() != nil) != (err != nil) {
+			t.Errorf("%s: got %q, %v, want %q, %v", in, got, l.Err(), want, err)
+		}
+	}
+}
+
+func TestInt(t *testing.T) {
+	for _, in := range []string{
+		"0", "-1", "9223372036854775807", "-9223372036854775808",
+		"9223372036854775808", "1.5", "1e2", "01", "-", "", "true",
+	} {
+		l := NewLexer([]byte(in))
+		got := l.Int(64)
+		l.End()
+		var want int64
+		err := json.Unmarshal([]byte(in), &want)
+		if got != want || (l.Err() != nil) != (err != nil) {
+			t.Errorf("%s: got %d, %v, want %d, %v", in, got, l.Err(), want, err)
+		}
+	}
+}
+
+func TestUint(t *testing.T) {
+	for _, in := range []string{"0", "255", "256", "-1"} {
+		l := NewLexer([]byte(in))
+		got := uint8(l.Uint(8))
+		l.End()
+		var want uint8
+		err := json.Unmarshal([]byte(in), &want)
+		if got != want || (l.Err() != nil) != (err != nil) {
+			t.Errorf("%s: got %d, %v, want %d, %v", in, got, l.Err(), want, err)
+		}
+	}
+}
+
+func TestFloat(t *testing.T) {
+	for _, in := range []string{
+		"0", "-0", "1.5", "-1.5e-7", "1E+2", "1e400", "1.", ".5", "1e", "-",
+	} {
+		l := NewLexer([]byte(in))
+		got := l.Float(64)
+		l.End()
+		var want float64
+		err := json.Unmarshal([]byte(in), &want)
+		if (l.Err() != nil) != (err != nil) || err == nil && math.Float64bits(got) != math.Float64bits(want) {
+			t.Errorf("%s: got %v, %v, want %v, %v", in, got, l.Err(), want, err)
+		}
+	}
+}
+
+func TestSkip(t *testing.T) {
+	for _, in := range []string{
+		`{"a":[1,"b",true,null,{}]}`,
+		`[1,]`,
+		`{"a":1,}`,
+		`{"a" 1}`,
+		`[1 2]`,
+		`nul`,
+		strings.Repeat("[", 10000) + strings.Repeat("]", 10000),
+		strings.Repeat("[", 10000) + "1" + strings.Repeat("]", 10000),
+		strings.Repeat("[", 10001) + strings.Repeat("]", 10001),
+		strings.Repeat(`{"a":`, 10001) + "1" + strings.Repeat("}", 10001),
+	} {
+		l := NewLexer([]byte(in))
+		l.Skip()
+		l.End()
+		var v interface{}
+		err := json.Unmarshal([]byte(in), &v)
+		if (l.Err() != nil) != (err != nil) {
+			t.Errorf("%.20s: got %v, want %v", in, l.Err(), err)
+		}
+	}
+}
+
+func TestEnd(t *testing.T) {
+	for _, in := range []string{"{} ", "{}\n\t", "{} x", "{}{}", "{}]"} {
+		l := NewLexer([]byte(in))
+		l.Skip()
+		l.End()
+		if got, want := l.Err() == nil, json.Valid([]byte(in)); got != want {
+			t.Errorf("%q: got %v, want valid %v", in, l.Err(), want)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	for _, tt := range []struct {
+		key  string
+		want string
+	}{
+		{"a", "a"},
+		{"A", "A"},
+		{"aB", "Ab"},
+		{"c", ""},
+	} {
+		if got := Fold([]byte(tt.key), "a", "A", "Ab"); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
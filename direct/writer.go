@@ -0,0 +1,216 @@
+// Package direct is the runtime of the methods generated by encjsongen
+// with -mode=direct, which write and parse JSON field by field instead of
+// through reflection.
+package direct
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// Writer builds JSON in a buffer. It keeps the first error, after which
+// the writes are ignored.
+type Writer struct {
+	buf    []byte
+	err    error
+	first  bool // no member is written yet to the current object
+	pooled bool
+}
+
+// maxPooled limits the buffers kept in the pool.
+const maxPooled = 64 << 10
+
+var pool = sync.Pool{
+	New: func() interface{} {
+		return &Writer{buf: make([]byte, 0, 1024)}
+	},
+}
+
+// GetWriter returns a Writer whose buffer is taken from the pool shared in
+// the process. Bytes of it returns a copy of the JSON and puts the Writer
+// back, after which it must not be used.
+func GetWriter() *Writer {
+	w := pool.Get().(*Writer)
+	w.pooled = true
+	return w
+}
+
+// Bytes returns the JSON written, or the first error.
+func (w *Writer) Bytes() ([]byte, error) {
+	if !w.pooled {
+		if w.err != nil {
+			return nil, w.err
+		}
+		return w.buf, nil
+	}
+	b, err := append([]byte(nil), w.buf...), w.err
+	if cap(w.buf) <= maxPooled {
+		*w = Writer{buf: w.buf[:0]}
+		pool.Put(w)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// ObjectStart starts an object.
+func (w *Writer) ObjectStart() {
+	w.buf = append(w.buf, '{')
+	w.first = true
+}
+
+// ObjectEnd ends the object.
+func (w *Writer) ObjectEnd() {
+	w.buf = append(w.buf, '}')
+	w.first = false
+}
+
+// Key writes the name of a member of the current object, which must be a
+// JSON string.
+func (w *Writer) Key(name string) {
+	if !w.first {
+		w.buf = append(w.buf, ',')
+	}
+	w.first = false
+	w.buf = append(w.buf, name...)
+	w.buf = append(w.buf, ':')
+}
+
+// Literal writes s as is.
+func (w *Writer) Literal(s string) {
+	w.buf = append(w.buf, s...)
+}
+
+// Bool writes a JSON boolean.
+func (w *Writer) Bool(v bool) {
+	w.buf = strconv.AppendBool(w.buf, v)
+}
+
+// Int writes a JSON number of an integer.
+func (w *Writer) Int(v int64) {
+	w.buf = strconv.AppendInt(w.buf, v, 10)
+}
+
+// Uint writes a JSON number of an unsigned integer.
+func (w *Writer) Uint(v uint64) {
+	w.buf = strconv.AppendUint(w.buf, v, 10)
+}
+
+// Float writes a JSON number of a floating-point number of the bit size,
+// formatted as encoding/json does. NaN and infinities are errors.
+func (w *Writer) Float(v float64, bits int) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		w.setError(fmt.Errorf("json: unsupported value: %s", strconv.FormatFloat(v, 'g', -1, bits)))
+		return
+	}
+	format := byte('f')
+	if abs := math.Abs(v); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	w.buf = strconv.AppendFloat(w.buf, v, format, -1, bits)
+	if format == 'e' {
+		// Clean up e-09 to e-9.
+		if n := len(w.buf); n >= 4 && w.buf[n-4] == 'e' && w.buf[n-3] == '-' && w.buf[n-2] == '0' {
+			w.buf[n-2] = w.buf[n-1]
+			w.buf = w.buf[:n-1]
+		}
+	}
+}
+
+// String writes a JSON string, escaped as encoding/json does.
+func (w *Writer) String(s string) {
+	w.buf = AppendString(w.buf, s)
+}
+
+// Raw writes data, the result of a marshaler, or keeps err. data is
+// validated and compacted, and HTML characters in its strings are escaped,
+// as encoding/json does with the results of marshalers.
+func (w *Writer) Raw(data []byte, err error) {
+	if err != nil {
+		w.setError(err)
+		return
+	}
+	n := len(w.buf)
+	buf := bytes.NewBuffer(w.buf)
+	if err := json.Compact(buf, data); err != nil {
+		w.buf = w.buf[:n]
+		w.setError(err)
+		return
+	}
+	w.buf = buf.Bytes()
+	if bytes.ContainsAny(w.buf[n:], "<>&\u2028\u2029") {
+		var escaped bytes.Buffer
+		json.HTMLEscape(&escaped, w.buf[n:])
+		w.buf = append(w.buf[:n], escaped.Bytes()...)
+	}
+}
+
+func (w *Writer) setError(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+const hex = "0123456789abcdef"
+
+// AppendString appends s to b as a JSON string, escaped as encoding/json
+// does including HTML characters. Invalid UTF-8 is replaced by U+FFFD.
+func AppendString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\b':
+				b = append(b, '\\', 'b')
+			case '\f':
+				b = append(b, '\\', 'f')
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028 and U+2029 are invalid in JavaScript strings.
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hex[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
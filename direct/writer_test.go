@@ -0,0 +1,104 @@
+package direct
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+// The tests compare the results of Writer with those of encoding/json.
+
+func TestAppendString(t *testing.T) {
+	for _, s := range []string{
+		"a", `"\`, "\b\f\n\r\t\x00\x1f", "<a href=\"x\">&</a>",
+		"\u2028\u2029", "\u00e9\u4e16\U0001f600", "\xff", "a\xc3", "\ufffd",
+	} {
+		want, _ := json.Marshal(s)
+		if got := AppendString(nil, s); string(got) != string(want) {
+			t.Errorf("%q: got %s, want %s", s, got, want)
+		}
+	}
+}
+
+func TestFloat64(t *testing.T) {
+	for _, v := range []float64{
+		0, math.Copysign(0, -1), 1, -1.5, 1e20, 1e21, 1e-6, 1e-7, 123456789.125,
+		math.MaxFloat64, math.SmallestNonzeroFloat64,
+	} {
+		var w Writer
+		w.Float(v, 64)
+		got, err := w.Bytes()
+		want, _ := json.Marshal(v)
+		if string(got) != string(want) || err != nil {
+			t.Errorf("%v: got %s, %v, want %s", v, got, err, want)
+		}
+	}
+}
+
+func TestFloat32(t *testing.T) {
+	for _, v := range []float32{1e20, 1e21, 1e-6, 1e-7, 0.1, math.MaxFloat32} {
+		var w Writer
+		w.Float(float64(v), 32)
+		got, err := w.Bytes()
+		want, _ := json.Marshal(v)
+		if string(got) != string(want) || err != nil {
+			t.Errorf("%v: got %s, %v, want %s", v, got, err, want)
+		}
+	}
+}
+
+func TestFloatUnsupported(t *testing.T) {
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		var w Writer
+		w.Float(v, 64)
+		if _, err := w.Bytes(); err == nil {
+			t.Errorf("%v: got no error", v)
+		}
+	}
+}
+
+func TestRaw(t *testing.T) {
+	errMarshal := errors.New("marshal")
+	for _, tt := range []struct {
+		data    string
+		err     error
+		want    string
+		wantErr bool
+	}{
+		{data: `{ "a" : [ 1, 2 ] }`, want: `{"k":{"a":[1,2]}}`},
+		{data: "\"<&>\u2028\"", want: `{"k":"\u003c\u0026\u003e\u2028"}`},
+		{data: "[ \"\u2029\" ]", want: `{"k":["\u2029"]}`},
+		{data: `{"a":`, wantErr: true},
+		{data: `1 2`, wantErr: true},
+		{data: ``, wantErr: true},
+		{err: errMarshal, wantErr: true},
+	} {
+		var w Writer
+		w.ObjectStart()
+		w.Key(`"k"`)
+		w.Raw([]byte(tt.data), tt.err)
+		w.ObjectEnd()
+		got, err := w.Bytes()
+		if string(got) != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%q: got %s, %v, want %s", tt.data, got, err, tt.want)
+		}
+		if tt.err != nil && err != tt.err {
+			t.Errorf("got %v, want %v", err, tt.err)
+		}
+	}
+}
+
+func TestGetWriter(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		w := GetWriter()
+		w.ObjectStart()
+		w.Key(`"a"`)
+		w.Int(int64(i))
+		w.ObjectEnd()
+		got, err := w.Bytes()
+		if want := `{"a":` + string(rune('0'+i)) + `}`; string(got) != want || err != nil {
+			t.Errorf("got %s, %v, want %s", got, err, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/daisuzu/encjsongen/generator"
+	"golang.org/x/tools/go/packages"
+)
+
+// gen runs the gen subcommand, which loads the packages of the patterns in
+// args by go/packages instead of the analysis framework, and returns the
+// exit code: 1 if any package fails to load or to generate, 2 for invalid
+// flags.
+func gen(args []string) int {
+	fs := flag.NewFlagSet("encjsongen gen", flag.ContinueOnError)
+	analyzer.Flags.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	tags := fs.String("tags", "", "comma-separated list of build tags to load the packages with")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: encjsongen gen [-flag] [pattern ...]\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	if _, err := newGenerator(nil); err != nil {
+		fmt.Fprintf(os.Stderr, "encjsongen: %v\n", err)
+		return 2
+	}
+	start := time.Now()
+	cfg := &packages.Config{Mode: generator.LoadMode}
+	if *tags != "" {
+		cfg.BuildFlags = []string{"-tags=" + *tags}
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "encjsongen: %v\n", err)
+		return 1
+	}
+	logf("loaded %d packages in %v", len(pkgs), time.Since(start).Round(time.Millisecond))
+	if packages.PrintErrors(pkgs) > 0 {
+		return 1
+	}
+
+	var (
+		mu     sync.Mutex
+		failed bool
+		wg     sync.WaitGroup
+	)
+	for _, p := range pkgs {
+		wg.Add(1)
+		go func(p *packages.Package) {
+			defer wg.Done()
+			report := func(d generator.Diagnostic) {
+				mu.Lock()
+				defer mu.Unlock()
+				failed = true
+				fmt.Fprintf(os.Stderr, "%s: %s\n", p.Fset.Position(d.Pos), d.Message)
+			}
+			pkg := &generator.Package{
+				Fset:      p.Fset,
+				Types:     p.Types,
+				TypesInfo: p.TypesInfo,
+				Syntax:    p.Syntax,
+				Dir:       generator.PackageDir(p),
+			}
+			g, err := packageGenerator(pkg)
+			if err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				failed = true
+				fmt.Fprintf(os.Stderr, "encjsongen: %s: %v\n", p.PkgPath, err)
+				return
+			}
+			generatePackage(g, pkg, report)
+		}(p)
+	}
+	wg.Wait()
+	logSummary(time.Since(start))
+	if failed {
+		return 1
+	}
+	return 0
+}
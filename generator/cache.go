@@ -0,0 +1,56 @@
+package generator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+)
+
+// cacheVersion is changed when the generated code changes for the same
+// declarations, to invalidate the caches.
+const cacheVersion = "1"
+
+// declSource returns the source of ts with its doc comment, on which the
+// generated methods depend.
+func declSource(fset *token.FileSet, ts *ast.TypeSpec, doc *ast.CommentGroup) ([]byte, error) {
+	b := new(bytes.Buffer)
+	if doc != nil {
+		for _, c := range doc.List {
+			fmt.Fprintln(b, c.Text)
+		}
+	}
+	if err := format.Node(b, fset, ts); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// inputHash returns the hash of the inputs of the file generated for
+// infos: the declarations, their build constraints and the options,
+// including the Config, and the constants of the enums and the types of
+// the variants of oneof, which are declared elsewhere.
+func (g *Generator) inputHash(infos []*structInfo) string {
+	h := sha256.New()
+	opts := g.opts
+	opts.Procs, opts.Unchanged, opts.Found, opts.Config = 0, nil, nil, nil
+	fmt.Fprintf(h, "%s\n%#v\n", cacheVersion, opts)
+	if g.opts.Config != nil {
+		fmt.Fprintf(h, "%#v\n", *g.opts.Config)
+	}
+	for _, si := range infos {
+		fmt.Fprintf(h, "%s\n%d\n", constraintString(si.constraint), len(si.src))
+		h.Write(si.src)
+		for _, e := range si.Enum {
+			fmt.Fprintf(h, "%s=%s\n", e.Const, e.val)
+		}
+		for _, f := range si.OneOf {
+			fmt.Fprintf(h, "%s %s\n", f.Name, types.TypeString(f.typ, nil))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,31 @@
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestInputHashEnum(t *testing.T) {
+	const src = `package main
+
+//encjsongen:enum Red=red Green=green
+type Color int
+
+const (
+	Red Color = iota + %d
+	Green
+)
+`
+	opts := Options{Unchanged: func(string, string) (bool, error) { return false, nil }}
+	hash := func(start int) string {
+		files, diags := generate(t, filepath.Join(t.TempDir(), "main.go"), fmt.Sprintf(src, start), opts)
+		if len(diags) > 0 || len(files) != 1 {
+			t.Fatalf("got %d files and %v", len(files), diags)
+		}
+		return files[0].Hash
+	}
+	if hash(0) == hash(1) {
+		t.Error("got the same hash for the constants of different values")
+	}
+}
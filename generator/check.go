@@ -0,0 +1,432 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// exprError is an error of type checking an expression of a tag, at
+// Offset in Src.
+type exprError struct {
+	What   string // the part of the tag, e.g. "expr" or "validate"
+	Src    string
+	Offset int
+	Msg    string
+}
+
+func (e *exprError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.What, e.Msg)
+}
+
+// checkExpr type checks src, the what of a tag in which "$" is op, in the
+// scope of the type, and returns its type, which is a *types.Tuple for
+// multiple values. ctx is declared of ctxType unless it is empty.
+//
+// "$" is substituted by placeholder, declared by op.bind in a function
+// literal wrapping src, and "$Name" by placeholder followed by the name,
+// declared of the field. The positions of the errors are kept in src,
+// which is parsed alone.
+func (si *structInfo) checkExpr(what, src string, op operand, ctxType string) (types.Type, error) {
+	e, err := parser.ParseExprFrom(si.fset, "", bindOperand(src, placeholder), 0)
+	if err != nil {
+		return nil, si.exprError(what, src, e, err)
+	}
+	var param string
+	if ctxType != "" {
+		param = "ctx " + ctxType
+	}
+	decls, err := si.fieldDecls(what, src)
+	if err != nil {
+		return nil, err
+	}
+	const hole = "encjsongen_hole"
+	body := decls + strings.Replace(op.bind, "%s", "_ = "+placeholder+"\nfunc(...interface{}) {}("+hole+")", 1)
+	wrapper, err := parser.ParseExprFrom(si.fset, "", "func("+param+") {\n"+body+"\n}", 0)
+	if err != nil {
+		return nil, err
+	}
+	wrapper = astutil.Apply(wrapper, nil, func(c *astutil.Cursor) bool {
+		if id, ok := c.Node().(*ast.Ident); ok && id.Name == hole {
+			c.Replace(e)
+		}
+		return true
+	}).(ast.Expr)
+
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}
+	if err := types.CheckExpr(si.fset, si.pkg, si.evalPos(), wrapper, info); err != nil {
+		return nil, si.exprError(what, src, e, err)
+	}
+	return info.Types[e].Type, nil
+}
+
+// fieldDecls returns the statements declaring the fields referred to by
+// src, the what of a tag, for checkExpr.
+func (si *structInfo) fieldDecls(what, src string) (string, error) {
+	refs := fieldRefs(src)
+	if len(refs) == 0 {
+		return "", nil
+	}
+	var (
+		b        strings.Builder
+		declared = make(map[string]bool)
+	)
+	for _, ref := range refs {
+		if _, err := si.field(ref.Name); err != nil {
+			return "", &exprError{What: what, Src: src, Offset: ref.Offset, Msg: err.Error()}
+		}
+		if declared[ref.Name] {
+			continue
+		}
+		declared[ref.Name] = true
+		fmt.Fprintf(&b, "%[1]s%[2]s := (*new(%[3]s%[4]s)).%[2]s\n_ = %[1]s%[2]s\n", placeholder, ref.Name, si.Receiver, si.TypeParams)
+	}
+	return b.String(), nil
+}
+
+// field returns the field name of the struct type of si, which "$Name"
+// refers to.
+func (si *structInfo) field(name string) (*types.Var, error) {
+	st, ok := si.typ.Underlying().(*types.Struct)
+	if !ok || si.Value != nil {
+		return nil, fmt.Errorf("$%s requires a struct type", name)
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		if f := st.Field(i); f.Name() == name && !f.Embedded() {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("$%s is not a field of %s", name, si.Receiver)
+}
+
+// checkAssign type checks assign, in which "$" is the value of expr, or of
+// the parameter of the function call passes it to if expr is empty, and
+// returns whether it returns (T, error). T must be assignable to op, or
+// T is a list of the values assignable to op.targets if any.
+func (si *structInfo) checkAssign(assign, expr string, exprErr bool, ctxType string, call *assignCall, op operand) (bool, error) {
+	var t types.Type
+	if expr != "" {
+		// "$" of ASSIGN shadows that of EXPR.
+		decl := placeholder + " := "
+		if exprErr {
+			decl = placeholder + ", _ := "
+		}
+		fields, err := si.fieldDecls("expr", expr)
+		if err != nil {
+			return false, err
+		}
+		bound := op
+		bound.bind = strings.Replace(op.bind, "%s", "_ = "+placeholder+"\n{\n"+fields+decl+bindOperand(expr, placeholder)+"\n%s\n}", 1)
+		if t, err = si.checkExpr("assign", assign, bound, ctxType); err != nil {
+			return false, err
+		}
+	} else {
+		t = call.sig.Results()
+		if tuple := t.(*types.Tuple); tuple.Len() == 1 {
+			t = tuple.At(0).Type()
+		}
+	}
+	if len(op.targets) > 0 {
+		return si.checkTargets(assign, t, op.targets)
+	}
+	rt, withErr, err := resultType(t)
+	if err != nil {
+		return false, &exprError{What: "assign", Src: assign, Msg: "must return T or (T, error)"}
+	}
+	if !types.AssignableTo(rt, op.typ) {
+		return false, &exprError{What: "assign", Src: assign, Msg: fmt.Sprintf("%s of %s is not assignable to %s", assign, si.typeString(rt), si.typeString(op.typ))}
+	}
+	return withErr, nil
+}
+
+// assignTargets returns the fields set by assign of the field name and its
+// right-hand side if it is an assignment such as "$First, $Last =
+// splitName($)", in which "$" alone is the field itself, or assign as it
+// is otherwise.
+func (si *structInfo) assignTargets(assign, name string) ([]*types.Var, string, error) {
+	var (
+		s     scanner.Scanner
+		depth int
+	)
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", -1, len(assign)), []byte(assign), nil, 0)
+	for {
+		pos, tok, _ := s.Scan()
+		switch tok {
+		case token.EOF:
+			return nil, assign, nil
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.ASSIGN:
+			if depth != 0 {
+				continue
+			}
+			off := fset.Position(pos).Offset
+			var targets []*types.Var
+			for _, lhs := range strings.Split(assign[:off], ",") {
+				lhs = strings.TrimSpace(lhs)
+				target := name
+				if lhs != "$" {
+					refs := fieldRefs(lhs)
+					if len(refs) != 1 || lhs != "$"+refs[0].Name {
+						return nil, "", &exprError{What: "assign", Src: assign, Msg: fmt.Sprintf("%q is not $ nor $Name of a field; want e.g. $First, $Last = splitName($)", lhs)}
+					}
+					target = refs[0].Name
+				}
+				f, err := si.field(target)
+				if err != nil {
+					return nil, "", &exprError{What: "assign", Src: assign, Msg: err.Error()}
+				}
+				for _, other := range targets {
+					if other == f {
+						return nil, "", &exprError{What: "assign", Src: assign, Msg: fmt.Sprintf("%s is set twice", target)}
+					}
+				}
+				targets = append(targets, f)
+			}
+			return targets, strings.TrimSpace(assign[off+1:]), nil
+		}
+	}
+}
+
+// checkTargets checks that t, the type of assign, is a list of the values
+// assignable to targets, optionally followed by an error, and returns
+// whether it is.
+func (si *structInfo) checkTargets(assign string, t types.Type, targets []*types.Var) (bool, error) {
+	var values []types.Type
+	if tuple, ok := t.(*types.Tuple); ok {
+		for i := 0; i < tuple.Len(); i++ {
+			values = append(values, tuple.At(i).Type())
+		}
+	} else {
+		values = []types.Type{t}
+	}
+	withErr := len(values) == len(targets)+1 && types.Identical(values[len(targets)], errorType)
+	if len(values) != len(targets) && !withErr {
+		return false, &exprError{What: "assign", Src: assign, Msg: fmt.Sprintf("must return %d values, optionally followed by an error, for the fields it sets, but returns %d", len(targets), len(values))}
+	}
+	for i, f := range targets {
+		if !types.AssignableTo(values[i], f.Type()) {
+			return false, &exprError{What: "assign", Src: assign, Msg: fmt.Sprintf("value %d of %s is not assignable to %s of %s", i+1, si.typeString(values[i]), f.Name(), si.typeString(f.Type()))}
+		}
+	}
+	return withErr, nil
+}
+
+// exprError returns err of checking src parsed as e, with the position in
+// src if err is there.
+func (si *structInfo) exprError(what, src string, e ast.Expr, err error) error {
+	ee := &exprError{What: what, Src: src, Msg: err.Error()}
+	pos := token.NoPos
+	switch err := err.(type) {
+	case types.Error:
+		ee.Msg, pos = err.Msg, err.Pos
+	case scanner.ErrorList:
+		ee.Msg = err[0].Msg
+		ee.Offset = toSrcOffset(src, err[0].Pos.Offset)
+		return ee
+	}
+	ee.Msg = strings.Replace(ee.Msg, placeholder, "$", -1)
+	if e != nil && pos.IsValid() && si.fset.File(pos) == si.fset.File(e.Pos()) {
+		ee.Offset = toSrcOffset(src, si.fset.Position(pos).Offset)
+	}
+	return ee
+}
+
+// toSrcOffset converts the offset in src with the "$" operands substituted
+// by the placeholder to that in src.
+func toSrcOffset(src string, offset int) int {
+	delta := 0
+	for _, off := range operandOffsets(src) {
+		if offset < off+delta+len(placeholder) {
+			if offset > off+delta {
+				return off
+			}
+			break
+		}
+		delta += len(placeholder) - 1
+	}
+	if offset-delta > len(src) {
+		return len(src)
+	}
+	return offset - delta
+}
+
+// tagRange returns the range of e in the tag of f under the key name, or
+// of the whole value of the key if e is nil or cannot be located there, or
+// the position of f if the tag cannot be read.
+func tagRange(f *ast.Field, name string, e *exprError) (pos, end token.Pos) {
+	lit := f.Tag.Value
+	tag, litOffsets, ok := unquoteOffsets(lit)
+	if !ok {
+		return f.Pos(), token.NoPos
+	}
+	start := -1
+	for i := 0; i+len(name)+2 <= len(tag); i++ {
+		if strings.HasPrefix(tag[i:], name+`:"`) && (i == 0 || tag[i-1] == ' ') {
+			start = i + len(name) + 1
+			break
+		}
+	}
+	if start < 0 {
+		return f.Pos(), token.NoPos
+	}
+	stop := start + 1
+	for ; stop < len(tag) && tag[stop] != '"'; stop++ {
+		if tag[stop] == '\\' {
+			stop++
+		}
+	}
+	if stop >= len(tag) {
+		return f.Pos(), token.NoPos
+	}
+	value, offsets, ok := unquoteOffsets(tag[start : stop+1])
+	if !ok {
+		return f.Pos(), token.NoPos
+	}
+	// The range of the value, without the quotes.
+	from, to := 0, len(value)
+	if e != nil {
+		if j := strings.Index(value, e.Src); j >= 0 {
+			from, to = j+e.Offset, j+len(e.Src)
+			if from > to {
+				from = to
+			}
+		}
+	}
+	toPos := func(i int) token.Pos {
+		return f.Tag.Pos() + token.Pos(litOffsets[start+offsets[i]])
+	}
+	return toPos(from), toPos(to)
+}
+
+// unquoteOffsets returns the content of the Go string literal q, with the
+// offsets in q of its bytes followed by that of the closing quote.
+func unquoteOffsets(q string) (string, []int, bool) {
+	if len(q) < 2 || q[0] != q[len(q)-1] {
+		return "", nil, false
+	}
+	var offsets []int
+	switch q[0] {
+	case '`':
+		for i := 1; i < len(q); i++ {
+			offsets = append(offsets, i)
+		}
+		return q[1 : len(q)-1], offsets, true
+	case '"':
+	default:
+		return "", nil, false
+	}
+	var b strings.Builder
+	for rest := q[1 : len(q)-1]; rest != ""; {
+		off := len(q) - 1 - len(rest)
+		r, multibyte, tail, err := strconv.UnquoteChar(rest, '"')
+		if err != nil {
+			return "", nil, false
+		}
+		n := b.Len()
+		if multibyte {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte(byte(r))
+		}
+		for ; n < b.Len(); n++ {
+			offsets = append(offsets, off)
+		}
+		rest = tail
+	}
+	return b.String(), append(offsets, len(q)-1), true
+}
+
+// addImports declares the packages of the space-separated import paths of
+// an import clause or the encjsongen:import directive to the expressions of
+// si. They must be imported by any file of the package, which is all the
+// type information there is of them.
+func (si *structInfo) addImports(paths string) error {
+	fields := strings.Fields(paths)
+	if len(fields) == 0 {
+		return errors.New("import requires an import path")
+	}
+	for _, importPath := range fields {
+		var p *types.Package
+		for _, imported := range si.pkg.Imports() {
+			if imported.Path() == importPath {
+				p = imported
+			}
+		}
+		if p == nil {
+			return fmt.Errorf("import %q is not imported by any file of the package", importPath)
+		}
+		for _, other := range si.imports {
+			if other.Name() == p.Name() && other != p {
+				return fmt.Errorf("import %q conflicts with %q as %s", importPath, other.Path(), p.Name())
+			}
+		}
+		if si.imports == nil {
+			si.imports = make(map[string]*types.Package)
+		}
+		si.imports[importPath] = p
+	}
+	si.scopePos = token.NoPos
+	return nil
+}
+
+// evalPos returns the position at which the expressions of si are type
+// checked. With imports, it is in a scope of its own below the package, a
+// copy of that of si.pos with the imports added, since the scope of the
+// file cannot be extended.
+func (si *structInfo) evalPos() token.Pos {
+	if len(si.imports) == 0 {
+		return si.pos
+	}
+	if si.scopePos.IsValid() {
+		return si.scopePos
+	}
+	f := si.fset.AddFile("", -1, 1)
+	scope := types.NewScope(si.pkg.Scope(), f.Pos(0), f.Pos(1), "encjsongen")
+	for _, p := range si.imports {
+		scope.Insert(types.NewPkgName(token.NoPos, si.pkg, p.Name(), p))
+	}
+	for s := si.pkg.Scope().Innermost(si.pos); s != nil && s != si.pkg.Scope(); s = s.Parent() {
+		for _, name := range s.Names() {
+			if scope.Lookup(name) == nil {
+				scope.Insert(s.Lookup(name))
+			}
+		}
+	}
+	si.scopePos = f.Pos(0)
+	return si.scopePos
+}
+
+// importSpecs returns the import declarations of the generated file for
+// imports and the packages of the presets, which goimports removes if
+// unused.
+func (si *structInfo) importSpecs() []string {
+	specs := make([]string, 0, len(si.imports))
+	for importPath, p := range si.imports {
+		spec := strconv.Quote(importPath)
+		if p.Name() != path.Base(importPath) {
+			spec = p.Name() + " " + spec
+		}
+		specs = append(specs, spec)
+	}
+	for _, a := range si.Aliases {
+		if a.path != "" && si.imports[a.path] == nil {
+			specs = append(specs, strconv.Quote(a.path))
+		}
+	}
+	sort.Strings(specs)
+	return specs
+}
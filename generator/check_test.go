@@ -0,0 +1,54 @@
+package generator
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTagRange(t *testing.T) {
+	const src = `package main
+
+import (
+	"fmt"
+	"time"
+)
+
+var _ = fmt.Sprint
+
+type T struct {
+	CreateTime time.Time ` + "`json:\"-\" customjson:\"%s\"`" + `
+}
+`
+	for _, tt := range []struct {
+		tag  string
+		want string // the source in the range
+		msg  string
+	}{
+		{tag: `createTime`, want: `createTime`, msg: `invalid tag: missing "=" between NAME and EXPR;ASSIGN, e.g. customjson:"createTime=$.Unix();time.Unix($, 0)"`},
+		{tag: `createTime=$.Unx();time.Unix($, 0)`, want: `Unx()`, msg: "invalid expr: $.Unx undefined"},
+		{tag: `createTime=$.Unix();time.Unix($, \"0\")`, want: `\"0\")`, msg: "invalid assign: cannot use"},
+		{tag: `createTime=$.Unix(]);time.Unix($, 0)`, want: `])`, msg: "invalid expr: expected operand"},
+		{tag: `createTime,omitemtpy=$.Unix();time.Unix($, 0)`, want: `omitemtpy`, msg: `invalid tag: unsupported option "omitemtpy"`},
+		{tag: `createTime=$.Unix();time.Unix($, 0);a;b`, want: `$.Unix();time.Unix($, 0);a;b`, msg: `invalid tag: 4 parts separated by ";"`},
+	} {
+		t.Run(tt.tag, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "main.go")
+			s := strings.Replace(src, "%s", tt.tag, 1)
+			fset, _, diags := diagnose(t, filename, s, Options{})
+			if len(diags) != 1 {
+				t.Fatalf("got %d diagnostics, want 1", len(diags))
+			}
+			d := diags[0]
+			if !strings.Contains(d.Message, tt.msg) {
+				t.Errorf("got %q, want %q", d.Message, tt.msg)
+			}
+			if !d.End.IsValid() {
+				t.Fatalf("got no end of %q", d.Message)
+			}
+			if got := s[fset.Position(d.Pos).Offset:fset.Position(d.End).Offset]; got != tt.want {
+				t.Errorf("got the range %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
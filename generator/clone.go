@@ -0,0 +1,148 @@
+package generator
+
+import (
+	"fmt"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// CloneStmts returns the statements replacing the memory shared by clone,
+// a shallow copy of the receiver, with copies of it.
+func (si *structInfo) CloneStmts() []string {
+	named, _ := types.Unalias(si.typ).(*types.Named)
+	stmt := si.cloneUnderlying("clone", si.typ, 0, []*types.Named{named})
+	if stmt == "" {
+		return nil
+	}
+	return []string{stmt}
+}
+
+// cloneStmt returns the statement replacing the memory shared by the
+// addressable x of type t with copies of it, or "" if x shares none.
+// Interfaces, channels, functions and pointers to opaque structs are
+// shared as they are, and so are the named types on stack, which refer to
+// themselves.
+//
+// The Clone methods of the types of the other packages are called, but not
+// the ones of the package so that the methods generated do not change the
+// next generation.
+func (si *structInfo) cloneStmt(x string, t types.Type, depth int, stack []*types.Named) string {
+	if named, ok := types.Unalias(t).(*types.Named); ok {
+		for _, n := range stack {
+			if n == named {
+				return ""
+			}
+		}
+		stack = append(stack, named)
+	}
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		if m := cloneMethod(p.Elem(), si.pkg); m != nil && types.Identical(m, t) {
+			return fmt.Sprintf("if %[1]s != nil {\n%[1]s = %[1]s.Clone()\n}", x)
+		}
+	}
+	if m := cloneMethod(t, si.pkg); m != nil {
+		if types.Identical(m, t) {
+			return fmt.Sprintf("%[1]s = %[2]s.Clone()", x, primary(x))
+		}
+		return fmt.Sprintf("%[1]s = *%[2]s.Clone()", x, primary(x))
+	}
+	return si.cloneUnderlying(x, t, depth, stack)
+}
+
+// cloneUnderlying is cloneStmt by the underlying type of t.
+func (si *structInfo) cloneUnderlying(x string, t types.Type, depth int, stack []*types.Named) string {
+	if _, ok := t.(*types.TypeParam); ok {
+		return ""
+	}
+	// The variables are numbered in the nested statements.
+	var n string
+	if depth > 0 {
+		n = strconv.Itoa(depth)
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Pointer:
+		if si.opaque(u.Elem()) {
+			return ""
+		}
+		e := "e" + n
+		stmt := fmt.Sprintf("if %[1]s != nil {\n%[2]s := *%[1]s\n", x, e)
+		if elem := si.cloneStmt(e, u.Elem(), depth+1, stack); elem != "" {
+			stmt += elem + "\n"
+		}
+		return stmt + fmt.Sprintf("%s = &%s\n}", x, e)
+	case *types.Slice:
+		aux, i := "aux"+n, "i"+n
+		stmt := fmt.Sprintf("if %[1]s != nil {\n%[2]s := make(%[3]s, len(%[1]s))\ncopy(%[2]s, %[1]s)\n", x, aux, si.typeString(t))
+		if elem := si.cloneStmt(aux+"["+i+"]", u.Elem(), depth+1, stack); elem != "" {
+			stmt += fmt.Sprintf("for %s := range %s {\n%s\n}\n", i, aux, elem)
+		}
+		return stmt + fmt.Sprintf("%s = %s\n}", x, aux)
+	case *types.Map:
+		aux, k, e := "aux"+n, "k"+n, "e"+n
+		stmt := fmt.Sprintf("if %[1]s != nil {\n%[2]s := make(%[3]s, len(%[1]s))\nfor %[4]s, %[5]s := range %[1]s {\n", x, aux, si.typeString(t), k, e)
+		if elem := si.cloneStmt(e, u.Elem(), depth+1, stack); elem != "" {
+			stmt += elem + "\n"
+		}
+		return stmt + fmt.Sprintf("%[2]s[%[3]s] = %[4]s\n}\n%[1]s = %[2]s\n}", x, aux, k, e)
+	case *types.Array:
+		i := "i" + n
+		if elem := si.cloneStmt(x+"["+i+"]", u.Elem(), depth+1, stack); elem != "" {
+			return fmt.Sprintf("for %s := range %s {\n%s\n}", i, x, elem)
+		}
+	case *types.Struct:
+		var stmts []string
+		for i := 0; i < u.NumFields(); i++ {
+			f := u.Field(i)
+			if !f.Exported() && f.Pkg() != si.pkg {
+				continue
+			}
+			if stmt := si.cloneStmt(x+"."+f.Name(), f.Type(), depth, stack); stmt != "" {
+				stmts = append(stmts, stmt)
+			}
+		}
+		return strings.Join(stmts, "\n")
+	}
+	return ""
+}
+
+// opaque reports whether t is a struct with fields inaccessible from the
+// package, whose values pointed to copied would share their memory.
+func (si *structInfo) opaque(t types.Type) bool {
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return false
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		if f := st.Field(i); !f.Exported() && f.Pkg() != si.pkg {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneMethod returns the result type of the method Clone() of *t if t is
+// of another package than pkg and the result is t or *t.
+func cloneMethod(t types.Type, pkg *types.Package) types.Type {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok || named.Obj().Pkg() == pkg {
+		return nil
+	}
+	sel := types.NewMethodSet(types.NewPointer(t)).Lookup(nil, "Clone")
+	if sel == nil {
+		return nil
+	}
+	m, ok := sel.Obj().(*types.Func)
+	if !ok {
+		return nil
+	}
+	sig := m.Type().(*types.Signature)
+	if sig.Params().Len() != 0 || sig.Results().Len() != 1 {
+		return nil
+	}
+	r := sig.Results().At(0).Type()
+	if !types.Identical(r, t) && !types.Identical(r, types.NewPointer(t)) {
+		return nil
+	}
+	return r
+}
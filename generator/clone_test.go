@@ -0,0 +1,60 @@
+package generator
+
+import "testing"
+
+func TestClone(t *testing.T) {
+	const src = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type Group struct {
+	Name string
+}
+
+type User struct {
+	Name       string
+	Group      *Group
+	Friends    []*User
+	Tags       map[string][]string
+	Scores     [2]*int
+	CreateTime time.Time ` + "`json:\"-\" customjson:\"createTime=$.Unix();time.Unix($, 0)\"`" + `
+}
+
+type cloner interface{ Clone() *User }
+
+func main() {
+	n := 1
+	u := &User{
+		Name:       "a",
+		Group:      &Group{Name: "g"},
+		Friends:    []*User{{Name: "b"}},
+		Tags:       map[string][]string{"x": {"y"}},
+		Scores:     [2]*int{&n},
+		CreateTime: time.Unix(1, 0),
+	}
+	c := interface{}(u).(cloner).Clone()
+	c.Name = "c"
+	c.Group.Name = "h"
+	c.Friends[0] = &User{Name: "d"}
+	c.Tags["x"][0] = "z"
+	*c.Scores[0] = 2
+	b, _ := json.Marshal(u)
+	fmt.Println(string(b))
+	b, _ = json.Marshal(c)
+	fmt.Println(string(b))
+	fmt.Println(interface{}((*User)(nil)).(cloner).Clone() == nil)
+}
+`
+	got := run(t, src, Options{Targets: []string{"json", "clone"}})
+	want := `{"Name":"a","Group":{"Name":"g"},"Friends":[{"Name":"b","Group":null,"Friends":null,"Tags":null,"Scores":[null,null],"createTime":-62135596800}],"Tags":{"x":["y"]},"Scores":[1,null],"createTime":1}
+{"Name":"c","Group":{"Name":"h"},"Friends":[{"Name":"d","Group":null,"Friends":null,"Tags":null,"Scores":[null,null],"createTime":-62135596800}],"Tags":{"x":["z"]},"Scores":[2,null],"createTime":1}
+true
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
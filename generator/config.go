@@ -0,0 +1,115 @@
+package generator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile is the name of the configuration file looked up at the module
+// root by the command.
+const ConfigFile = "encjsongen.yaml"
+
+// Config declares conversions of many types centrally instead of in their
+// tags, e.g.
+//
+//	rules:
+//	  - package: example.com/app/model/...
+//	    type: "*Event"
+//	    fields:
+//	      CreateTime: createTime=@unix
+//	    types:
+//	      time.Duration: $.String();time.ParseDuration($)
+//	    output: "{name}_gen.go"
+type Config struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule applies to the types matched by Package and Type. The rules are
+// applied in order, and the first one giving a field, a type or an option
+// wins.
+type Rule struct {
+	Package   string            `yaml:"package"`   // pattern of import paths, in which "..." matches any string; all packages if empty
+	Type      string            `yaml:"type"`      // path.Match pattern of type names; all types if empty
+	Fields    map[string]string `yaml:"fields"`    // customjson tags by field name, unless the field has a tag or a directive
+	Types     map[string]string `yaml:"types"`     // EXPR;ASSIGN or @PRESET by field type, as with Options.TypeMap
+	Output    string            `yaml:"output"`    // overrides Options.Output
+	Strict    bool              `yaml:"strict"`    // as with the encjsongen:strict directive
+	UseNumber bool              `yaml:"usenumber"` // as with the encjsongen:usenumber directive
+}
+
+// LoadConfig reads the Config of filename.
+func LoadConfig(filename string) (*Config, error) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	c := new(Config)
+	if err := yaml.Unmarshal(src, c); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", filename, err)
+	}
+	for i, r := range c.Rules {
+		if r.Type != "" {
+			if _, err := path.Match(r.Type, ""); err != nil {
+				return nil, fmt.Errorf("invalid type of rule %d in %s: %v", i+1, filename, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+// rule returns the merged rules of Options.Config applying to the type
+// name of the package of pkgPath.
+func (g *Generator) rule(pkgPath, name string) Rule {
+	var merged Rule
+	if g.opts.Config == nil {
+		return merged
+	}
+	for _, r := range g.opts.Config.Rules {
+		if r.Package != "" && !matchPackage(r.Package, pkgPath) {
+			continue
+		}
+		if r.Type != "" {
+			if ok, _ := path.Match(r.Type, name); !ok {
+				continue
+			}
+		}
+		merged.Fields = mergeMap(merged.Fields, r.Fields)
+		merged.Types = mergeMap(merged.Types, r.Types)
+		if merged.Output == "" {
+			merged.Output = r.Output
+		}
+		merged.Strict = merged.Strict || r.Strict
+		merged.UseNumber = merged.UseNumber || r.UseNumber
+	}
+	return merged
+}
+
+// mergeMap adds the entries of src missing in dst.
+func mergeMap(dst, src map[string]string) map[string]string {
+	for k, v := range src {
+		if _, ok := dst[k]; ok {
+			continue
+		}
+		if dst == nil {
+			dst = make(map[string]string)
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+// matchPackage reports whether pkgPath matches pattern as package patterns
+// of the go command do, where "x/..." matches x too.
+func matchPackage(pattern, pkgPath string) bool {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.Replace(re, `\.\.\.`, `.*`, -1)
+	if strings.HasSuffix(re, `/.*`) {
+		re = strings.TrimSuffix(re, `/.*`) + `(/.*)?`
+	}
+	return regexp.MustCompile("^" + re + "$").MatchString(pkgPath)
+}
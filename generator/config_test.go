@@ -0,0 +1,122 @@
+package generator
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), ConfigFile)
+	writeFile(t, filename, `rules:
+  - package: example.com/app/model/...
+    type: "*Event"
+    fields:
+      CreateTime: createTime=@unix
+    types:
+      time.Duration: $.String();time.ParseDuration($)
+    output: "{name}_gen.go"
+    strict: true
+  - usenumber: true
+`)
+	got, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Config{Rules: []Rule{
+		{
+			Package: "example.com/app/model/...",
+			Type:    "*Event",
+			Fields:  map[string]string{"CreateTime": "createTime=@unix"},
+			Types:   map[string]string{"time.Duration": "$.String();time.ParseDuration($)"},
+			Output:  "{name}_gen.go",
+			Strict:  true,
+		},
+		{UseNumber: true},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	writeFile(t, filename, "rules:\n  - type: \"[\"\n")
+	if _, err := LoadConfig(filename); err == nil || !strings.Contains(err.Error(), "invalid type of rule 1") {
+		t.Errorf("got %v, want the error of the type pattern", err)
+	}
+}
+
+func TestMatchPackage(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"example.com/app", "example.com/app", true},
+		{"example.com/app", "example.com/app/model", false},
+		{"example.com/app/...", "example.com/app", true},
+		{"example.com/app/...", "example.com/app/model", true},
+		{"example.com/app/...", "example.com/application", false},
+		{"example.com/.../model", "example.com/app/model", true},
+		{"example.com/a.p", "example.com/axp", false},
+	} {
+		if got := matchPackage(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchPackage(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestConfigRules(t *testing.T) {
+	const src = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type Event struct {
+	CreateTime time.Time
+	Timeout    time.Duration
+	Name       string
+}
+
+// Other is not matched by the type of the rule of Event.
+type Other struct {
+	Timeout time.Duration
+}
+
+func main() {
+	b, err := json.Marshal(&Event{CreateTime: time.Unix(1, 0), Timeout: time.Second, Name: "a"})
+	fmt.Println(string(b), err)
+	var v Event
+	fmt.Println(json.Unmarshal([]byte("{\"createTime\":2,\"Timeout\":\"1m\",\"Name\":\"b\"}"), &v), v.CreateTime.Unix(), v.Timeout, v.Name)
+	fmt.Println(json.Unmarshal([]byte("{\"unknown\":1}"), &v) != nil)
+	b, err = json.Marshal(&Other{Timeout: time.Second})
+	fmt.Println(string(b), err)
+}
+`
+	cfg := &Config{Rules: []Rule{
+		{
+			Package: "main",
+			Type:    "E*",
+			Fields:  map[string]string{"CreateTime": "createTime=@unix"},
+			Strict:  true,
+		},
+		{
+			Type:  "Event",
+			Types: map[string]string{"time.Duration": "$.String();time.ParseDuration($)"},
+		},
+		{
+			Package: "example.com/...",
+			Fields:  map[string]string{"Timeout": "timeout=$;$"},
+		},
+	}}
+	const want = `{"CreateTime":"1970-01-01T00:00:01Z","Name":"a","createTime":1,"Timeout":"1s"} <nil>
+<nil> 2 1m0s b
+true
+{"Timeout":1000000000} <nil>
+`
+	if got := run(t, src, Options{Config: cfg}); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
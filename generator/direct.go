@@ -0,0 +1,532 @@
+package generator
+
+import (
+	"fmt"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/daisuzu/encjsongen/direct"
+)
+
+// directPkg is the runtime of the methods generated with -mode=direct.
+const directPkg = "github.com/daisuzu/encjsongen/direct"
+
+// directJSON is the json target with -mode=direct, which writes and reads
+// the JSON field by field. Values of other than basic types and slices of
+// them are still passed to json.Marshal and json.Unmarshal.
+var directJSON = &target{
+	imports: func(o *Options) []string {
+		return append(jsonImports(o), strconv.Quote(directPkg))
+	},
+	marshal:        tmplDirectMarshalJSON,
+	unmarshal:      tmplDirectUnmarshalJSON,
+	marshalNamed:   tmplDirectMarshalNamed,
+	unmarshalNamed: tmplDirectUnmarshalNamed,
+	marshalOneOf:   tmplMarshalOneOf,
+	unmarshalOneOf: tmplUnmarshalOneOf,
+	marshalEnum:    tmplEnum,
+	unmarshalEnum:  tmplUnmarshalEnum,
+}
+
+// directFields returns the wireFields of marshal which the direct mode
+// supports.
+func (si *structInfo) directFields(marshal bool) ([]jsonField, error) {
+	fields := si.wireFields(marshal)
+	for _, f := range fields {
+		if f.alias != nil {
+			if f.alias.Inline() {
+				return nil, fmt.Errorf("-mode=direct does not support the inline option of %s", f.alias.Target)
+			}
+			if f.str {
+				return nil, fmt.Errorf("-mode=direct does not support the string option of %s", f.alias.Target)
+			}
+			continue
+		}
+		if f.str {
+			return nil, fmt.Errorf("-mode=direct does not support the string option of %s", f.path[len(f.path)-1].Name())
+		}
+		for _, e := range f.path[:len(f.path)-1] {
+			if _, ok := e.Type().Underlying().(*types.Pointer); ok {
+				return nil, fmt.Errorf("-mode=direct does not support %s embedded by pointer", e.Name())
+			}
+		}
+	}
+	return fields, nil
+}
+
+// wireFields returns the fields encoded by MarshalJSON, or decoded by
+// UnmarshalJSON unless marshal, as encoding/json would with the alias
+// struct of the reflect mode.
+func (si *structInfo) wireFields(marshal bool) []jsonField {
+	// The aliases follow the fields of the embedded *Alias.
+	fields := collectFields(nil, si.typ.Underlying().(*types.Struct), nil)
+	for i := range si.Aliases {
+		a := &si.Aliases[i]
+		if marshal && a.Expr == "" || !marshal && a.Assign == "" {
+			continue
+		}
+		if a.Inline() {
+			fields = append(fields, a.inlineFields()...)
+			continue
+		}
+		fields = append(fields, jsonField{
+			key:       a.Key(),
+			typ:       a.aliasType,
+			omitempty: strings.Contains(a.JSONKey, ",omitempty"),
+			str:       strings.Contains(a.JSONKey, ",string"),
+			depth:     -1,
+			alias:     a,
+		})
+	}
+
+	// Of the fields with the same key, the shallowest one is encoded
+	// unless there are more than one of them without exactly one tagged.
+	dominants := make(map[string]*jsonField)
+	for i := range fields {
+		f := &fields[i]
+		d, ok := dominants[f.key]
+		switch {
+		case !ok || f.depth < d.depth:
+			dominants[f.key] = f
+		case f.depth > d.depth:
+		case d.tagged == f.tagged:
+			dominants[f.key] = nil
+		case f.tagged:
+			dominants[f.key] = f
+		}
+	}
+	var result []jsonField
+	for i := range fields {
+		if f := &fields[i]; dominants[f.key] == f {
+			result = append(result, *f)
+		}
+	}
+	return result
+}
+
+// selector returns the selector of f from the receiver recv.
+func (f jsonField) selector(recv string) string {
+	names := []string{recv}
+	for _, e := range f.path {
+		names = append(names, e.Name())
+	}
+	return strings.Join(names, ".")
+}
+
+// DirectEncodes returns the statements writing the members of the object
+// by w.
+func (si *structInfo) DirectEncodes() ([]string, error) {
+	fields, err := si.directFields(true)
+	if err != nil {
+		return nil, err
+	}
+	var stmts []string
+	for _, f := range fields {
+		x, bound := f.selector(si.Recv), true
+		var omit string
+		if a := f.alias; a != nil {
+			// Prepares binds the values of some EXPR, and of all under omitif.
+			x, bound = "alias"+a.Target, a.Kind != "" || a.ExprErr
+			if a.OmitIf != "" {
+				x, bound, omit = "(*omit"+a.Target+")", true, "omit"+a.Target+" != nil"
+			}
+		}
+		var cond string
+		if f.omitempty {
+			var skip bool
+			if cond, skip, err = si.directNonEmpty(x, f.typ); err != nil {
+				return nil, err
+			}
+			if skip {
+				continue
+			}
+		}
+		switch {
+		case omit != "" && cond != "":
+			cond = omit + " && " + cond
+		case omit != "":
+			cond = omit
+		}
+		var stmt string
+		if !bound {
+			stmt = fmt.Sprintf("%s := %s\n", x, f.alias.Expr)
+		}
+		write := fmt.Sprintf("w.Key(%s)\n%s", goString(string(direct.AppendString(nil, f.key))), si.directEncode(x, true, f.typ))
+		if cond != "" {
+			write = fmt.Sprintf("if %s {\n%s\n}", cond, write)
+		}
+		stmts = append(stmts, stmt+write)
+	}
+	return stmts, nil
+}
+
+// DirectDecodes returns the cases of the keys reading the members of the
+// object by l.
+func (si *structInfo) DirectDecodes() ([]string, error) {
+	fields, err := si.directFields(false)
+	if err != nil {
+		return nil, err
+	}
+	var cases []string
+	for _, f := range fields {
+		x := f.selector(si.Recv)
+		if f.alias != nil {
+			x = "aux." + f.alias.Field
+		}
+		cases = append(cases, fmt.Sprintf("case %s:\n%s", strconv.Quote(f.key), si.directDecode(x, f.typ)))
+	}
+	return cases, nil
+}
+
+// DirectKeys returns the keys read by UnmarshalJSON as the arguments of
+// direct.Fold.
+func (si *structInfo) DirectKeys() (string, error) {
+	fields, err := si.directFields(false)
+	if err != nil {
+		return "", err
+	}
+	var keys []string
+	for _, f := range fields {
+		keys = append(keys, strconv.Quote(f.key))
+	}
+	return strings.Join(keys, ", "), nil
+}
+
+// Pooled reports whether MarshalJSON takes the buffer from the pool of
+// the runtime by Options.Pool.
+func (si *structInfo) Pooled() bool {
+	return si.opts.Pool
+}
+
+// DirectEncodeValue returns the statements writing aux of a named type.
+func (si *structInfo) DirectEncodeValue() string {
+	return si.directEncode("aux", true, si.Value.aliasType)
+}
+
+// DirectDecodeValue returns the statements reading aux of a named type.
+func (si *structInfo) DirectDecodeValue() string {
+	return si.directDecode("aux", si.Value.aliasType)
+}
+
+// directEncode returns the statements writing x of type t by w, taking
+// its address for json.Marshal if addr.
+func (si *structInfo) directEncode(x string, addr bool, t types.Type) string {
+	if b := directBasic(t); b != nil {
+		switch info := b.Info(); {
+		case info&types.IsBoolean != 0:
+			return fmt.Sprintf("w.Bool(%s)", convert(x, t, types.Typ[types.Bool]))
+		case info&types.IsUnsigned != 0:
+			return fmt.Sprintf("w.Uint(%s)", convert(x, t, types.Typ[types.Uint64]))
+		case info&types.IsInteger != 0:
+			return fmt.Sprintf("w.Int(%s)", convert(x, t, types.Typ[types.Int64]))
+		case info&types.IsFloat != 0:
+			return fmt.Sprintf("w.Float(%s, %d)", convert(x, t, types.Typ[types.Float64]), floatBits(b))
+		default:
+			return fmt.Sprintf("w.String(%s)", convert(x, t, types.Typ[types.String]))
+		}
+	}
+	if e := directSliceElem(t); e != nil {
+		return fmt.Sprintf("if %[1]s == nil {\nw.Literal(`null`)\n} else {\nw.Literal(`[`)\nfor i, e := range %[1]s {\nif i > 0 {\nw.Literal(`,`)\n}\n%[2]s\n}\nw.Literal(`]`)\n}", x, si.directEncode("e", false, e))
+	}
+	if addr {
+		x = "&" + x
+	}
+	return fmt.Sprintf("w.Raw(json.Marshal(%s))", x)
+}
+
+// directDecode returns the statements reading x of type t by l. x is
+// set only if the value is read without an error, so that it is left as
+// it is on a type mismatch, as encoding/json does.
+func (si *structInfo) directDecode(x string, t types.Type) string {
+	if b := directBasic(t); b != nil {
+		var (
+			read string
+			from types.Type
+		)
+		switch info := b.Info(); {
+		case info&types.IsBoolean != 0:
+			read, from = "l.Bool()", types.Typ[types.Bool]
+		case info&types.IsUnsigned != 0:
+			read, from = fmt.Sprintf("l.Uint(%d)", intBits(b)), types.Typ[types.Uint64]
+		case info&types.IsInteger != 0:
+			read, from = fmt.Sprintf("l.Int(%d)", intBits(b)), types.Typ[types.Int64]
+		case info&types.IsFloat != 0:
+			read, from = fmt.Sprintf("l.Float(%d)", floatBits(b)), types.Typ[types.Float64]
+		default:
+			read, from = "l.Str()", types.Typ[types.String]
+		}
+		if !types.Identical(t, from) {
+			read = fmt.Sprintf("%s(%s)", si.typeString(t), read)
+		}
+		// null leaves the value as encoding/json does.
+		return fmt.Sprintf("if !l.Null() {\nif value := %s; l.Err() == nil {\n%s = value\n}\n}", read, x)
+	}
+	if e := directSliceElem(t); e != nil {
+		return fmt.Sprintf(`if l.Null() {
+%[1]s = nil
+} else {
+value := %[2]s{}
+l.Delim('[')
+for l.More() {
+var e %[3]s
+%[4]s
+value = append(value, e)
+l.Comma()
+}
+l.Delim(']')
+if l.Err() == nil {
+%[1]s = value
+}
+}`, x, si.typeString(t), si.typeString(e), si.directDecode("e", e))
+	}
+	if si.UseNumber {
+		return fmt.Sprintf(`{
+dec := json.NewDecoder(bytes.NewReader(l.Raw()))
+dec.UseNumber()
+l.AddError(dec.Decode(&%s))
+}`, x)
+	}
+	return fmt.Sprintf("l.AddError(json.Unmarshal(l.Raw(), &%s))", x)
+}
+
+// directNonEmpty returns the condition of x of type t to be encoded with
+// omitempty, or skip if it is always empty.
+func (si *structInfo) directNonEmpty(x string, t types.Type) (cond string, skip bool, err error) {
+	if _, ok := t.(*types.TypeParam); ok {
+		return "", false, fmt.Errorf("-mode=direct does not support omitempty of %s of a type parameter", x)
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch info := u.Info(); {
+		case info&types.IsBoolean != 0:
+			return x, false, nil
+		case info&types.IsString != 0:
+			return x + ` != ""`, false, nil
+		default:
+			return x + " != 0", false, nil
+		}
+	case *types.Slice, *types.Map:
+		return fmt.Sprintf("len(%s) != 0", x), false, nil
+	case *types.Array:
+		return "", u.Len() == 0, nil
+	case *types.Pointer, *types.Interface:
+		return x + " != nil", false, nil
+	}
+	// Structs are never empty.
+	return "", false, nil
+}
+
+// directBasic returns the underlying type of t if the direct mode writes
+// and reads it.
+func directBasic(t types.Type) *types.Basic {
+	if _, ok := t.(*types.TypeParam); ok || hasJSONMethods(t) {
+		return nil
+	}
+	b, ok := t.Underlying().(*types.Basic)
+	if !ok || b.Info()&(types.IsBoolean|types.IsInteger|types.IsFloat|types.IsString) == 0 || b.Kind() == types.UnsafePointer {
+		return nil
+	}
+	return b
+}
+
+// directSliceElem returns the element type of t if the direct mode writes
+// and reads t as a slice of it. []byte is encoded in base64.
+func directSliceElem(t types.Type) types.Type {
+	if _, ok := t.(*types.TypeParam); ok || hasJSONMethods(t) {
+		return nil
+	}
+	s, ok := t.Underlying().(*types.Slice)
+	if !ok || directBasic(s.Elem()) == nil {
+		return nil
+	}
+	if b, ok := s.Elem().Underlying().(*types.Basic); ok && b.Kind() == types.Byte {
+		return nil
+	}
+	return s.Elem()
+}
+
+// hasJSONMethods reports whether t customizes its encoding by methods of
+// json.Marshaler, encoding.TextMarshaler or their unmarshalers.
+func hasJSONMethods(t types.Type) bool {
+	mset := types.NewMethodSet(types.NewPointer(t))
+	for _, name := range []string{"MarshalJSON", "UnmarshalJSON", "MarshalText", "UnmarshalText"} {
+		if mset.Lookup(nil, name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// convert returns x converted to the basic type to unless it is of it.
+func convert(x string, t types.Type, to *types.Basic) string {
+	if types.Identical(t, to) {
+		return x
+	}
+	return fmt.Sprintf("%s(%s)", to.Name(), x)
+}
+
+func intBits(b *types.Basic) int {
+	switch b.Kind() {
+	case types.Int8, types.Uint8:
+		return 8
+	case types.Int16, types.Uint16:
+		return 16
+	case types.Int32, types.Uint32:
+		return 32
+	case types.Int64, types.Uint64:
+		return 64
+	}
+	return 0
+}
+
+func floatBits(b *types.Basic) int {
+	if b.Kind() == types.Float32 {
+		return 32
+	}
+	return 64
+}
+
+// goString returns s as a Go string literal, raw unless s has backquotes.
+func goString(s string) string {
+	if strings.Contains(s, "`") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
+
+const tmplDirectMarshalJSON = `func ({{.Recv}} {{.MarshalReceiver}}) MarshalJSON() ([]byte, error) {
+	{{- if .BeforeMarshal }}
+	if err := {{.Recv}}.BeforeMarshalJSON(); err != nil {
+		return nil, err
+	}
+	{{- end }}
+	{{- range .Prepares "return nil, err" }}
+	{{.}}
+	{{- end }}
+	{{- if .Pooled }}
+	w := direct.GetWriter()
+	{{- else }}
+	var w direct.Writer
+	{{- end }}
+	w.ObjectStart()
+	{{- range .DirectEncodes }}
+	{{.}}
+	{{- end }}
+	w.ObjectEnd()
+	return w.Bytes()
+}
+`
+
+const tmplDirectUnmarshalJSON = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) UnmarshalJSON(b []byte) error {
+	{{- if .Reset }}
+	*{{.Recv}} = {{.Receiver}}{{.TypeParams}}{}
+	{{- end }}
+	{{- if .Assigns }}
+	var aux struct {
+		{{- range .Aliases }}{{ if .Assign }}
+		{{.Field}} {{.Type}}
+		{{- end }}{{ end }}
+	}
+	{{- end }}
+	{{- if .NeedsKeys }}
+	keys := make(map[string]json.RawMessage)
+	{{- end }}
+	l := direct.NewLexer(b)
+	if !l.Null() {
+		l.Delim('{')
+		for l.More() {
+			key := l.Key()
+			{{- if .NeedsKeys }}
+			keys[direct.Fold(key, {{ .DirectKeys }})] = l.Peek()
+			{{- end }}
+			switch direct.Fold(key, {{ .DirectKeys }}) {
+			{{- range .DirectDecodes }}
+			{{.}}
+			{{- end }}
+			default:
+				{{- if .Strict }}
+				l.AddError(fmt.Errorf("json: unknown field %q", key))
+				{{- else }}
+				l.Skip()
+				{{- end }}
+			}
+			l.Comma()
+		}
+		l.Delim('}')
+	}
+	l.End()
+	if err := l.Err(); err != nil {
+		return err
+	}
+	{{- range .Required }}
+	if _, ok := keys["{{.}}"]; !ok {
+		return fmt.Errorf("{{$.Receiver}}: missing required key %q", "{{.}}")
+	}
+	{{- end }}
+	{{- if .AssignErr }}
+	var err error
+	{{- end }}
+	{{- range .Assigns }}
+	{{.}}
+	{{- end }}
+	{{- range .Validates }}
+	{{.}}
+	{{- end }}
+	{{- if .AfterUnmarshal }}
+	return {{.Recv}}.AfterUnmarshalJSON()
+	{{- else }}
+	return nil
+	{{- end }}
+}
+`
+
+const tmplDirectMarshalNamed = `func ({{.Recv}} {{.MarshalReceiver}}) MarshalJSON() ([]byte, error) {
+	{{- if .BeforeMarshal }}
+	if err := {{.Recv}}.BeforeMarshalJSON(); err != nil {
+		return nil, err
+	}
+	{{- end }}
+	{{- with .Value }}{{ if .ExprErr }}
+	aux, err := {{.Expr}}
+	if err != nil {
+		return nil, err
+	}
+	{{- else }}
+	aux := {{.Expr}}
+	{{- end }}{{ end }}
+	{{- if .Pooled }}
+	w := direct.GetWriter()
+	{{- else }}
+	var w direct.Writer
+	{{- end }}
+	{{ .DirectEncodeValue }}
+	return w.Bytes()
+}
+`
+
+const tmplDirectUnmarshalNamed = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) UnmarshalJSON(b []byte) error {
+	{{- with .Value }}
+	var aux {{.Type}}
+	{{- end }}
+	l := direct.NewLexer(b)
+	{{ .DirectDecodeValue }}
+	l.End()
+	if err := l.Err(); err != nil {
+		return err
+	}
+	{{- with .Value }}{{ if .AssignErr }}
+	var err error
+	if *{{$.Recv}}, err = {{.Assign}}; err != nil {
+		return err
+	}
+	{{- else }}
+	*{{$.Recv}} = {{.Assign}}
+	{{- end }}{{ end }}
+	{{- if .AfterUnmarshal }}
+	return {{.Recv}}.AfterUnmarshalJSON()
+	{{- else }}
+	return nil
+	{{- end }}
+}
+`
@@ -0,0 +1,41 @@
+package generator
+
+import "testing"
+
+func TestDirectTypeMismatch(t *testing.T) {
+	const src = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type User struct {
+	Name  string ` + "`json:\"name\"`" + `
+	Age   int    ` + "`json:\"age\"`" + `
+	Tags  []int  ` + "`json:\"tags\"`" + `
+	Score int    ` + "`json:\"-\" customjson:\"score=$;$\"`" + `
+}
+
+func main() {
+	for _, in := range []string{
+		"{\"name\":1}",
+		"{\"age\":\"a\"}",
+		"{\"tags\":[2,\"a\"]}",
+		"{\"tags\":\"a\"}",
+	} {
+		v := User{Name: "a", Age: 1, Tags: []int{1}, Score: 1}
+		err := json.Unmarshal([]byte(in), &v)
+		fmt.Println(v.Name, v.Age, v.Tags, v.Score, err != nil)
+	}
+}
+`
+	const want = `a 1 [1] 1 true
+a 1 [1] 1 true
+a 1 [1] 1 true
+a 1 [1] 1 true
+`
+	if got := run(t, src, Options{Mode: "direct"}); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
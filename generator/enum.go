@@ -0,0 +1,150 @@
+package generator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/types"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// enumValue is a constant of an integer type with the encjsongen:enum
+// directive, encoded as Name.
+type enumValue struct {
+	Const string
+	Name  string
+	val   string // of the constant, for Options.Unchanged
+}
+
+// Literal returns the JSON of the name quoted as a Go string.
+func (e enumValue) Literal() string {
+	b, _ := json.Marshal(e.Name)
+	return rawLiteral(string(b))
+}
+
+// Quoted returns the name quoted as a Go string.
+func (e enumValue) Quoted() string {
+	return rawLiteral(e.Name)
+}
+
+// rawLiteral returns s as a raw string literal unless s has a backquote.
+func rawLiteral(s string) string {
+	if strings.Contains(s, "`") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
+
+// SetEnum makes si an integer type encoded as the strings by the
+// "CONST=NAME ..." of the encjsongen:enum directive, in which NAME is
+// CONST if omitted.
+func (si *structInfo) SetEnum(directive string) error {
+	if b, ok := si.typ.Underlying().(*types.Basic); !ok || b.Info()&types.IsInteger == 0 {
+		return fmt.Errorf("enum requires an integer type, but %s is %s", si.Receiver, si.typeString(si.typ.Underlying()))
+	}
+	consts := make(map[string]bool)
+	names := make(map[string]bool)
+	for _, pair := range strings.Fields(directive) {
+		c, name := pair, pair
+		if i := strings.Index(pair, "="); i >= 0 {
+			c, name = pair[:i], pair[i+1:]
+		}
+		if c == "" || name == "" {
+			return fmt.Errorf("invalid enum: %q is not CONST=NAME", pair)
+		}
+		obj, ok := si.pkg.Scope().Lookup(c).(*types.Const)
+		if !ok || !types.Identical(obj.Type(), si.typ) {
+			return fmt.Errorf("invalid enum: %s is not a constant of %s", c, si.Receiver)
+		}
+		if consts[obj.Val().ExactString()] {
+			return fmt.Errorf("invalid enum: duplicate value of %s", c)
+		}
+		consts[obj.Val().ExactString()] = true
+		if names[name] {
+			return fmt.Errorf("invalid enum: duplicate name %q", name)
+		}
+		names[name] = true
+		si.Enum = append(si.Enum, enumValue{Const: c, Name: name, val: obj.Val().ExactString()})
+	}
+	if len(si.Enum) == 0 {
+		return errors.New("enum requires CONST=NAME")
+	}
+	return nil
+}
+
+// ParseFunc returns the name of the function parsing the names of an
+// enum, exported if the type is.
+func (si *structInfo) ParseFunc() string {
+	r, size := utf8.DecodeRuneInString(si.Receiver)
+	if unicode.IsUpper(r) {
+		return "Parse" + si.Receiver
+	}
+	return "parse" + string(unicode.ToUpper(r)) + si.Receiver[size:]
+}
+
+// String formats the values other than the constants as conversions,
+// where %d does not call String. MarshalJSON has a value receiver whatever
+// Options.ValueReceiver says, as the values of enums are rarely
+// addressable, e.g. constants, struct fields of values and map values.
+const tmplEnum = `func ({{.Recv}} {{.Receiver}}{{.TypeParams}}) String() string {
+	switch {{.Recv}} {
+	{{- range .Enum }}
+	case {{.Const}}:
+		return {{.Quoted}}
+	{{- end }}
+	}
+	return fmt.Sprintf("{{.Receiver}}(%d)", {{.Recv}})
+}
+
+// {{.ParseFunc}} returns the {{.Receiver}} named s.
+func {{.ParseFunc}}(s string) ({{.Receiver}}, error) {
+	switch s {
+	{{- range .Enum }}
+	case {{.Quoted}}:
+		return {{.Const}}, nil
+	{{- end }}
+	}
+	return 0, fmt.Errorf("{{.Receiver}}: unknown value %q", s)
+}
+
+func ({{.Recv}} {{.Receiver}}{{.TypeParams}}) MarshalJSON() ([]byte, error) {
+	{{- if .BeforeMarshal }}
+	if err := {{.Recv}}.BeforeMarshalJSON(); err != nil {
+		return nil, err
+	}
+	{{- end }}
+	switch {{.Recv}} {
+	{{- range .Enum }}
+	case {{.Const}}:
+		return []byte({{.Literal}}), nil
+	{{- end }}
+	}
+	return nil, fmt.Errorf("{{.Receiver}}: unknown value %d", {{.Recv}})
+}
+`
+
+// UnmarshalJSON leaves the value as it is on null, as json.Unmarshal does,
+// instead of parsing "".
+const tmplUnmarshalEnum = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(b, &text); err != nil {
+		return err
+	}
+	aux, err := {{.ParseFunc}}(text)
+	if err != nil {
+		return err
+	}
+	*{{.Recv}} = aux
+	{{- if .AfterUnmarshal }}
+	return {{.Recv}}.AfterUnmarshalJSON()
+	{{- else }}
+	return nil
+	{{- end }}
+}
+`
@@ -0,0 +1,82 @@
+package generator
+
+import "testing"
+
+func TestEnumMarshalValue(t *testing.T) {
+	const src = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+//encjsongen:enum Red=red Green=green
+type Color int
+
+const (
+	Red Color = iota
+	Green
+)
+
+func main() {
+	for _, v := range []interface{}{
+		Green,
+		struct{ C Color }{Green},
+		map[string]Color{"a": Green},
+	} {
+		b, err := json.Marshal(v)
+		fmt.Println(string(b), err)
+	}
+}
+`
+	got := run(t, src, Options{})
+	want := `"green" <nil>
+{"C":"green"} <nil>
+{"a":"green"} <nil>
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEnumUnmarshalNull(t *testing.T) {
+	const src = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+//encjsongen:enum Red=red Green=green
+type Color int
+
+const (
+	Red Color = iota
+	Green
+)
+
+type T struct {
+	C Color ` + "`json:\"c\"`" + `
+}
+
+func main() {
+	for _, in := range []string{
+		"{\"c\":null}",
+		"{\"c\":\"red\"}",
+		"{\"c\":\"blue\"}",
+	} {
+		v := T{C: Green}
+		err := json.Unmarshal([]byte(in), &v)
+		fmt.Println(v.C, err != nil)
+	}
+}
+`
+	got := run(t, src, Options{})
+	want := `green false
+red false
+green true
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
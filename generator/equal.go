@@ -0,0 +1,133 @@
+package generator
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+)
+
+// OtherArg returns the argument of Equal converted as the receiver.
+func (si *structInfo) OtherArg() string {
+	if si.opts.ValueReceiver {
+		return "other"
+	}
+	return "&other"
+}
+
+// EqualAssigns returns the statements setting the fields of aux to the
+// alias values, which Prepares computes.
+func (si *structInfo) EqualAssigns() []string {
+	var stmts []string
+	for _, a := range si.Aliases {
+		switch {
+		case a.Expr == "":
+		case a.OmitIf != "":
+			stmts = append(stmts, fmt.Sprintf("aux.%s = omit%s", a.Field, a.Target))
+		default:
+			stmts = append(stmts, fmt.Sprintf("aux.%s = %s", a.Field, a.value()))
+		}
+	}
+	return stmts
+}
+
+// EqualConds returns the condition of Equal, under which every field
+// encoded by MarshalJSON is equal between the receiver and other, compared
+// by the alias values in lhs and rhs for the converted fields.
+func (si *structInfo) EqualConds() string {
+	var conds []string
+	inlined := make(map[*alias]bool)
+	for _, f := range si.wireFields(true) {
+		if a := f.alias; a != nil {
+			// The inline values are compared as a whole.
+			if inlined[a] {
+				continue
+			}
+			inlined[a] = a.Inline()
+			t := a.aliasType
+			if a.OmitIf != "" {
+				t = types.NewPointer(t)
+			}
+			conds = append(conds, si.equalCond("lhs."+a.Field, "rhs."+a.Field, t))
+			continue
+		}
+		// The fields are absent through the nil embedded pointers.
+		var nils []string
+		x, y := si.Recv, "other"
+		for _, e := range f.path[:len(f.path)-1] {
+			x, y = x+"."+e.Name(), y+"."+e.Name()
+			if _, ok := e.Type().Underlying().(*types.Pointer); ok {
+				nils = append(nils, x+" == nil")
+				conds = append(conds, fmt.Sprintf("(%s == nil) == (%s == nil)", x, y))
+			}
+		}
+		name := f.path[len(f.path)-1].Name()
+		cond := si.equalCond(x+"."+name, y+"."+name, f.typ)
+		if len(nils) > 0 {
+			cond = "(" + strings.Join(append(nils, cond), " || ") + ")"
+		}
+		conds = append(conds, cond)
+	}
+	if len(conds) == 0 {
+		return "true"
+	}
+	return strings.Join(conds, " &&\n")
+}
+
+// ValueEqual returns the condition of Equal of a named non-struct type,
+// whose values converted are bound to lhs and rhs.
+func (si *structInfo) ValueEqual() string {
+	return si.equalCond("lhs", "rhs", si.Value.aliasType)
+}
+
+// equalCond returns the condition under which x and y of type t are equal,
+// by the Equal method of t if any as time.Time has, and of the values
+// pointed to for pointers.
+func (si *structInfo) equalCond(x, y string, t types.Type) string {
+	if deepEqual(t) {
+		return fmt.Sprintf("reflect.DeepEqual(%s, %s)", x, y)
+	}
+	if hasEqual(t) {
+		return fmt.Sprintf("%s.Equal(%s)", primary(x), y)
+	}
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		return fmt.Sprintf("(%[1]s == nil) == (%[2]s == nil) &&\n(%[1]s == nil || %[3]s)", x, y, si.equalCond("*"+x, "*"+y, p.Elem()))
+	}
+	return x + " == " + y
+}
+
+// deepEqual reports whether equalCond compares the values of t by
+// reflect.DeepEqual, which follows the pointers without copying the
+// values, as they may have locks.
+func deepEqual(t types.Type) bool {
+	if _, ok := t.(*types.TypeParam); ok {
+		return true
+	}
+	if hasEqual(t) {
+		return false
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Pointer:
+		return deepEqual(u.Elem())
+	case *types.Slice, *types.Map, *types.Interface:
+		return true
+	}
+	return !types.Comparable(t)
+}
+
+// hasEqual reports whether the values of t have the method Equal(t) bool.
+func hasEqual(t types.Type) bool {
+	sel := types.NewMethodSet(t).Lookup(nil, "Equal")
+	if sel == nil {
+		return false
+	}
+	m, ok := sel.Obj().(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := m.Type().(*types.Signature)
+	if sig.Params().Len() != 1 || sig.Results().Len() != 1 || !types.Identical(sig.Params().At(0).Type(), t) {
+		return false
+	}
+	b, ok := sig.Results().At(0).Type().(*types.Basic)
+	return ok && b.Kind() == types.Bool
+}
@@ -0,0 +1,70 @@
+package generator
+
+import "testing"
+
+func TestEqual(t *testing.T) {
+	const src = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type Group struct {
+	Name string
+}
+
+type User struct {
+	Name       string
+	Tags       []string
+	Group      *Group
+	CreateTime time.Time ` + "`json:\"-\" customjson:\"createTime=$.Unix();time.Unix($, 0)\"`" + `
+	Birthday   time.Time
+}
+
+//encjsongen:marshal $ / 10;$ * 10
+type Score int
+
+type equaler interface{ Equal(User) bool }
+
+func main() {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	u := User{Name: "a", Tags: []string{"x"}, Group: &Group{Name: "g"}, CreateTime: now, Birthday: now}
+	b, err := json.Marshal(&u)
+	if err != nil {
+		panic(err)
+	}
+	var decoded User
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		panic(err)
+	}
+	for _, v := range []User{
+		decoded,
+		{Name: "a", Tags: []string{"x"}, Group: &Group{Name: "g"}, CreateTime: now.Add(time.Second), Birthday: now},
+		{Name: "a", Tags: []string{"y"}, Group: &Group{Name: "g"}, CreateTime: now, Birthday: now},
+		{Name: "a", Tags: []string{"x"}, Group: &Group{Name: "h"}, CreateTime: now, Birthday: now},
+		{Name: "a", Tags: []string{"x"}, CreateTime: now, Birthday: now},
+		{Name: "a", Tags: []string{"x"}, Group: &Group{Name: "g"}, CreateTime: now, Birthday: now.In(time.FixedZone("", 3600))},
+	} {
+		fmt.Println(interface{}(&u).(equaler).Equal(v))
+	}
+	s := Score(12)
+	fmt.Println(interface{}(&s).(interface{ Equal(Score) bool }).Equal(19), interface{}(&s).(interface{ Equal(Score) bool }).Equal(20))
+}
+`
+	got := run(t, src, Options{Targets: []string{"json", "equal"}})
+	// The nanoseconds of CreateTime are lost by $.Unix(), and Birthday is
+	// compared by time.Time.Equal regardless of the location.
+	want := `true
+false
+false
+false
+false
+true
+true false
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
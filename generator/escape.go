@@ -0,0 +1,68 @@
+package generator
+
+import "strings"
+
+// literalDollar stands for "\$" of a tag between unescape and substitute,
+// so that it is not taken as the operand. It is a character of the private
+// use area, which is valid in the string literals it is meant for.
+const literalDollar = "\uE000"
+
+// splitTag splits s by sep, except for the seps in the string and rune
+// literals of the expressions and those escaped by a backslash, such as
+// the ";" of `strings.Split($, ";")` and `\;`.
+func splitTag(s string, sep byte) []string {
+	var (
+		parts []string
+		quote byte // of the literal s[i] is in, if any
+		start int
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && quote != '`':
+			i++ // the escaped character
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescape resolves the escapes of a part of a tag split by splitTag: `\;`
+// and `\=` are the characters themselves, and `\$` is literalDollar. The
+// other backslashes, such as of `\n` or `\\` in string literals, are kept.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case ';', '=':
+			b.WriteByte(s[i])
+		case '$':
+			b.WriteString(literalDollar)
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// literal returns the unescaped s with the escaped "$" as they are.
+func literal(s string) string {
+	return strings.Replace(s, literalDollar, "$", -1)
+}
@@ -0,0 +1,79 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitTag(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want []string
+	}{
+		{s: `$.Unix();time.Unix($, 0)`, want: []string{`$.Unix()`, `time.Unix($, 0)`}},
+		{s: `strings.Join($, ";");strings.Split($, ";")`, want: []string{`strings.Join($, ";")`, `strings.Split($, ";")`}},
+		{s: `strings.Count($, string(';'));`, want: []string{`strings.Count($, string(';'))`, ``}},
+		{s: "strings.Join($, `;\\`);x", want: []string{"strings.Join($, `;\\`)", "x"}},
+		{s: `strings.Join($, "\";");x`, want: []string{`strings.Join($, "\";")`, `x`}},
+		{s: `func() int { n := $\; return n }();x`, want: []string{`func() int { n := $\; return n }()`, `x`}},
+		{s: `x;default=y;validate=$ > 0`, want: []string{`x`, `default=y`, `validate=$ > 0`}},
+	} {
+		if got := splitTag(tt.s, ';'); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitTag(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want string
+	}{
+		{s: `$.Unix()`, want: `$.Unix()`},
+		{s: `func() int { n := $\; return n }()`, want: `func() int { n := $; return n }()`},
+		{s: `a\=b`, want: `a=b`},
+		{s: `f($, \$)`, want: "f($, " + literalDollar + ")"},
+		{s: `strings.Split($, "\n")`, want: `strings.Split($, "\n")`},
+		{s: `"\\"`, want: `"\\"`},
+		{s: `x\`, want: `x\`},
+	} {
+		if got := unescape(tt.s); got != tt.want {
+			t.Errorf("unescape(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestEscapedTag(t *testing.T) {
+	const src = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+var _ = strings.Split
+
+type T struct {
+	Tags []string ` + "`json:\"-\" customjson:\"tags=strings.Join($, \\\";\\\");strings.Split($, \\\";\\\")\"`" + `
+	N    int      ` + "`json:\"-\" customjson:\"n=func() int { n := $\\\\; return n * 2 }();$ / 2;validate=$ != 1\"`" + `
+	S    string   ` + "`json:\"-\" customjson:\"s=strings.Count($, string(';'));strings.Repeat(\\\";\\\", $)\"`" + `
+}
+
+func main() {
+	b, err := json.Marshal(&T{Tags: []string{"a", "b"}, N: 2, S: ";;;"})
+	fmt.Println(string(b), err)
+	var v T
+	err = json.Unmarshal([]byte("{\"tags\":\"c;d\",\"n\":8,\"s\":2}"), &v)
+	fmt.Printf("%q %d %q %v\n", v.Tags, v.N, v.S, err)
+	fmt.Println(json.Unmarshal([]byte("{\"n\":2}"), &v) != nil)
+}
+`
+	const want = `{"tags":"a;b","n":4,"s":3} <nil>
+["c" "d"] 4 ";;" <nil>
+true
+`
+	if got := run(t, src, Options{}); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,160 @@
+package generator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// duplicateKey returns the diagnostic of field name of f, converted by a
+// of its customjson tag, if MarshalJSON would encode the field under its
+// original key besides the key of a, with the fix adding json:"-".
+func duplicateKey(f *ast.Field, name string, a *alias) (Diagnostic, bool) {
+	jsonTag := fieldTag(f).Get("json")
+	if jsonTag == "-" || a.Expr == "" {
+		return Diagnostic{}, false
+	}
+	key, _, _ := strings.Cut(jsonTag, ",")
+	if key == "" {
+		key = name
+	}
+	if a.Inline() {
+		return Diagnostic{
+			Pos:     f.Pos(),
+			Message: fmt.Sprintf(`%s is encoded under %q besides inline; add json:"-" to its tag`, name, key),
+			Fix:     retagFix(`Add json:"-"`, f, "json", "-"),
+		}, true
+	}
+	if key == a.Key() {
+		return Diagnostic{}, false
+	}
+	return Diagnostic{
+		Pos:     f.Pos(),
+		Message: fmt.Sprintf(`%s is encoded under both %q and %q; add json:"-" to its tag`, name, key, a.Key()),
+		Fix:     retagFix(`Add json:"-"`, f, "json", "-"),
+	}, true
+}
+
+// tagKey matches the beginning of the next key of a struct tag.
+var tagKey = regexp.MustCompile(` [^ :"]+:"`)
+
+// malformedTag returns the diagnostic of f if its tag has the key name
+// whose value cannot be read, with the fix quoting the value if it is not
+// quoted.
+func malformedTag(f *ast.Field, name string) (Diagnostic, bool) {
+	tag := string(fieldTag(f))
+	if _, ok := fieldTag(f).Lookup(name); ok {
+		return Diagnostic{}, false
+	}
+	key := name + ":"
+	i := strings.Index(tag, key)
+	if i < 0 || i > 0 && tag[i-1] != ' ' {
+		return Diagnostic{}, false
+	}
+	d := Diagnostic{Pos: f.Tag.Pos(), End: f.Tag.End(), Message: "malformed " + name + " tag"}
+	rest := tag[i+len(key):]
+	end := len(rest)
+	if loc := tagKey.FindStringIndex(rest); loc != nil {
+		end = loc[0]
+	}
+	if value := strings.TrimSpace(rest[:end]); value != "" && value[0] != '"' {
+		d.Message += ": the value must be quoted"
+		d.Fix = tagFix("Quote the "+name+" tag", f, tag[:i]+key+strconv.Quote(value)+rest[end:])
+	}
+	return d, true
+}
+
+// optionsFix returns the fix removing the unsupported options from the
+// NAME segment of the tag of f under the key name, or nil if there are none.
+func optionsFix(f *ast.Field, name string) *Fix {
+	tag := fieldTag(f).Get(name)
+	i := strings.Index(tag, "=")
+	if i < 0 {
+		return nil
+	}
+	opts := strings.Split(tag[:i], ",")
+	kept := opts[:1]
+	for _, opt := range opts[1:] {
+		if nameOptions[opt] {
+			kept = append(kept, opt)
+		}
+	}
+	if len(kept) == len(opts) {
+		return nil
+	}
+	return retagFix("Remove the unsupported options", f, name, strings.Join(kept, ",")+tag[i:])
+}
+
+// retagFix returns the fix setting key to value in the tag of f, or nil
+// if the tag cannot be rewritten.
+func retagFix(message string, f *ast.Field, key, value string) *Fix {
+	tag := string(fieldTag(f))
+	if old, ok := fieldTag(f).Lookup(key); ok {
+		kv := key + ":" + strconv.Quote(old)
+		if !strings.Contains(tag, kv) {
+			return nil
+		}
+		tag = strings.Replace(tag, kv, key+":"+strconv.Quote(value), 1)
+	} else {
+		tag = strings.TrimSpace(key + ":" + strconv.Quote(value) + " " + tag)
+	}
+	return tagFix(message, f, tag)
+}
+
+// tagFix returns the fix replacing the tag of f with tag.
+func tagFix(message string, f *ast.Field, tag string) *Fix {
+	lit := "`" + tag + "`"
+	if strings.Contains(tag, "`") {
+		lit = strconv.Quote(tag)
+	}
+	return &Fix{
+		Message: message,
+		Edits:   []Edit{{Pos: f.Tag.Pos(), End: f.Tag.End(), NewText: []byte(lit)}},
+	}
+}
+
+// removeLineFix returns the fix removing the line of the comment at pos.
+func removeLineFix(message string, fset *token.FileSet, pos token.Pos) *Fix {
+	tf := fset.File(pos)
+	line := tf.Line(pos)
+	end := token.Pos(tf.Base() + tf.Size())
+	if line < tf.LineCount() {
+		end = tf.LineStart(line + 1)
+	}
+	return &Fix{
+		Message: message,
+		Edits:   []Edit{{Pos: tf.LineStart(line), End: end}},
+	}
+}
+
+// aliasDiagnostic returns the diagnostic of the alias declaration ts of
+// typ, on which methods cannot be declared, with the fix declaring it as a
+// defined type if it is an alias of an unnamed type.
+func aliasDiagnostic(pkg *types.Package, ts *ast.TypeSpec, typ types.Type) Diagnostic {
+	name := ts.Name.Name
+	switch t := types.Unalias(typ).(type) {
+	case *types.Named:
+		if t.Obj().Pkg() != pkg {
+			return Diagnostic{
+				Pos:     ts.Pos(),
+				Message: fmt.Sprintf("cannot define methods on %s, an alias of %s of another package", name, types.TypeString(t, nil)),
+			}
+		}
+		return Diagnostic{
+			Pos:     ts.Pos(),
+			Message: fmt.Sprintf("%s is an alias of %s; convert %s instead", name, t.Obj().Name(), t.Obj().Name()),
+		}
+	}
+	return Diagnostic{
+		Pos:     ts.Pos(),
+		Message: fmt.Sprintf(`cannot define methods on %s, an alias of an unnamed type; declare it without "="`, name),
+		Fix: &Fix{
+			Message: fmt.Sprintf("Declare %s as a defined type", name),
+			Edits:   []Edit{{Pos: ts.Assign, End: ts.Type.Pos()}},
+		},
+	}
+}
@@ -0,0 +1,71 @@
+package generator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"strings"
+)
+
+// funcPrefix marks EXPR or ASSIGN referring to a function by name, such as
+// "func:encodeTS", which is called with "$".
+const funcPrefix = "func:"
+
+// funcRef returns conv, the what of a tag, as the call of the function it
+// refers to if it has funcPrefix, in which case the function must take a
+// single parameter, to which in is assignable if not nil, and return T or
+// (T, error).
+func (si *structInfo) funcRef(what, conv string, in types.Type) (string, error) {
+	if !strings.HasPrefix(conv, funcPrefix) {
+		return conv, nil
+	}
+	name := conv[len(funcPrefix):]
+	fail := func(format string, args ...interface{}) error {
+		return &exprError{What: what, Src: conv, Offset: len(funcPrefix), Msg: fmt.Sprintf(format, args...)}
+	}
+	e, err := parser.ParseExpr(name)
+	if err != nil {
+		return "", fail("%s is not a function name", name)
+	}
+	var id *ast.Ident
+	switch e := e.(type) {
+	case *ast.Ident:
+		id = e
+	case *ast.SelectorExpr:
+		x, ok := e.X.(*ast.Ident)
+		if !ok {
+			return "", fail("%s is not a function name", name)
+		}
+		id = x
+	default:
+		return "", fail("%s is not a function name", name)
+	}
+	if si.shadowed(id.Name) {
+		return "", fail("%s is shadowed by the variable of the same name in the generated methods; rename it", id.Name)
+	}
+	tv, err := types.Eval(si.fset, si.pkg, si.evalPos(), name)
+	if err != nil {
+		if te, ok := err.(types.Error); ok {
+			return "", fail("%s", te.Msg)
+		}
+		return "", fail("%v", err)
+	}
+	sig, ok := tv.Type.(*types.Signature)
+	if !ok || tv.IsType() {
+		return "", fail("%s is not a function", name)
+	}
+	if sig.TypeParams().Len() > 0 {
+		return "", fail("%s is generic", name)
+	}
+	if sig.Params().Len() != 1 || sig.Variadic() {
+		return "", fail("%s must take a single parameter, but is %s", name, si.typeString(sig))
+	}
+	if r := sig.Results(); r.Len() != 1 && (r.Len() != 2 || !types.Identical(r.At(1).Type(), errorType)) {
+		return "", fail("%s must return T or (T, error), but is %s", name, si.typeString(sig))
+	}
+	if param := sig.Params().At(0).Type(); in != nil && !types.AssignableTo(in, param) {
+		return "", fail("%s takes %s, to which %s is not assignable", name, si.typeString(param), si.typeString(in))
+	}
+	return name + "($)", nil
+}
@@ -0,0 +1,45 @@
+package generator
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFuncRefShadowed(t *testing.T) {
+	const src = `package main
+
+import "strconv"
+
+func dec(s string) (int, error)    { return strconv.Atoi(s) }
+func aliasT(s string) (int, error) { return strconv.Atoi(s) }
+func decode(s string) (int, error) { return strconv.Atoi(s) }
+
+//encjsongen:strict
+type S struct {
+	T int ` + "`json:\"-\" customjson:\"t=strconv.Itoa($);func:%s\"`" + `
+}
+`
+	for _, tt := range []struct {
+		name string
+		want string
+	}{
+		{name: "dec", want: "dec is shadowed by the variable of the same name in the generated methods"},
+		{name: "aliasT", want: "aliasT is shadowed by the variable of the same name in the generated methods"},
+		{name: "decode"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "main.go")
+			files, diags := generate(t, filename, strings.Replace(src, "%s", tt.name, 1), Options{})
+			if tt.want == "" {
+				if len(diags) > 0 || len(files) == 0 {
+					t.Errorf("got %d files and %q, want a file", len(files), diags)
+				}
+				return
+			}
+			if len(diags) != 1 || !strings.Contains(diags[0], tt.want) {
+				t.Errorf("got %q, want %q", diags, tt.want)
+			}
+		})
+	}
+}
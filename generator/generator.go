@@ -0,0 +1,2401 @@
+// Package generator generates the methods of encjsongen from the customjson
+// tags and the encjsongen directives of type-checked packages, for tools
+// embedding it instead of running the command.
+package generator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/imports"
+	gofumpt "mvdan.cc/gofumpt/format"
+)
+
+// LoadMode is the mode in which Generate needs the packages to be loaded.
+const LoadMode = packages.NeedName | packages.NeedFiles | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo
+
+// Options configure the generated files as the flags of the command of the
+// same names do. The empty fields are the defaults of the flags.
+type Options struct {
+	Output        string   // -output, "{name}" followed by Suffix if empty
+	Suffix        string   // -suffix, "_json.go" if empty
+	Tag           string   // -tag, "customjson" if empty
+	LocalPrefix   string   // -local, set to imports.LocalPrefix while formatting
+	Gofumpt       bool     // -gofumpt
+	SingleFile    string   // -single-file
+	BuildTags     string   // -buildtags
+	Header        []byte   // the content of -header-file
+	JSONPkg       string   // -json-pkg, "encoding/json" if empty
+	Targets       []string // -target, "json" if empty
+	BSONPkg       string   // -bson-pkg, "go.mongodb.org/mongo-driver/v2/bson" if empty
+	MsgpackPkg    string   // -msgpack-pkg, "github.com/vmihailenco/msgpack/v5" if empty
+	GenTests      bool     // -gen-tests
+	GenBenchmarks bool     // -gen-benchmarks
+	GenFuzz       bool     // -gen-fuzz
+	SchemaOut     string   // -schema-out
+	OpenAPIOut    string   // -openapi-out
+	TSOut         string   // -ts-out
+	Strict        bool     // -strict
+	UseNumber     bool     // -use-number
+	Mode          string   // -mode, "reflect" if empty
+	Naming        string   // -naming, the field names as they are if empty
+	Receiver      string   // -receiver, "v" if empty
+	ValueReceiver bool     // -value-receiver
+	Pool          bool     // -pool
+	Procs         int      // files generated in parallel for each package, the number of CPUs if 0
+	Config        *Config  // the rules of encjsongen.yaml, if not nil
+
+	// TypeMap converts the fields of the types, e.g. "time.Time" or
+	// "example.com/pkg.T", by EXPR;ASSIGN or @PRESET under their json keys,
+	// unless they are converted otherwise.
+	TypeMap map[string]string
+
+	// Templates replace the templates of MarshalJSON and UnmarshalJSON of
+	// the struct types of -target=json in -mode=reflect by the names
+	// "MarshalJSON" and "UnmarshalJSON", as the files of -template-dir do.
+	Templates map[string]string
+
+	// Unchanged, if not nil, reports whether filename is generated from
+	// the inputs of hash already, in which case it is not generated again.
+	// The hash is given by File.Hash otherwise.
+	Unchanged func(filename, hash string) (bool, error)
+
+	// Found, if not nil, is called with each type whose methods are
+	// generated, e.g. to log the progress.
+	Found func(pos token.Position, name string)
+}
+
+// File is a file generated for a package.
+type File struct {
+	Name    string
+	Content []byte
+	Pos     token.Pos // of the first type of the file
+	Hash    string    // of the inputs, set if Options.Unchanged is not nil
+}
+
+// Diagnostic is a problem of a declaration, for which no file is
+// generated.
+type Diagnostic struct {
+	Pos     token.Pos
+	End     token.Pos // of the range of the problem, if known
+	Message string
+	Fix     *Fix // of the problem, if any
+}
+
+// Fix is a change of the source fixing a Diagnostic, which editors may
+// apply.
+type Fix struct {
+	Message string
+	Edits   []Edit
+}
+
+// Edit replaces the source between Pos and End with NewText.
+type Edit struct {
+	Pos     token.Pos
+	End     token.Pos
+	NewText []byte
+}
+
+// reporter adds a Diagnostic.
+type reporter func(d Diagnostic)
+
+// Reportf adds a Diagnostic without Fix.
+func (r reporter) Reportf(pos token.Pos, format string, args ...interface{}) {
+	r(Diagnostic{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// Package is a type-checked package to generate files for, as given by
+// go/packages or by an analysis.Pass.
+type Package struct {
+	Fset      *token.FileSet
+	Types     *types.Package
+	TypesInfo *types.Info
+	Syntax    []*ast.File
+
+	// Dir is the directory of the source files, in which the outputs are
+	// resolved. If empty, it is derived from the file names in Fset.
+	Dir string
+}
+
+// FileDir returns the directory of the source file of pos, which is Dir
+// if set.
+func (p *Package) FileDir(pos token.Pos) string {
+	if p.Dir != "" {
+		return p.Dir
+	}
+	name := p.Fset.File(pos).Name()
+	// The files processed by cgo are in the build cache, and refer to the
+	// source files by line directives.
+	if adjusted := p.Fset.PositionFor(pos, true).Filename; filepath.IsAbs(adjusted) && strings.HasSuffix(adjusted, ".go") {
+		name = adjusted
+	}
+	if abs, err := filepath.Abs(name); err == nil {
+		name = abs
+	}
+	return filepath.Dir(name)
+}
+
+// Generator generates files with Options.
+type Generator struct {
+	opts Options
+	fileOptions
+}
+
+// fileOptions are applied to every generated file.
+type fileOptions struct {
+	tags    constraint.Expr
+	header  []byte
+	targets []*target
+}
+
+// New returns a Generator with opts, or an error if they are invalid.
+func New(opts Options) (*Generator, error) {
+	if opts.Tag == "" {
+		opts.Tag = "customjson"
+	}
+	if strings.ContainsAny(opts.Tag, " :\"`") || opts.Tag == "json" {
+		return nil, fmt.Errorf("invalid -tag %q", opts.Tag)
+	}
+	if opts.Suffix == "" {
+		opts.Suffix = "_json.go"
+	} else if opts.Output != "" {
+		return nil, errors.New("-output and -suffix are exclusive")
+	}
+	if !strings.HasSuffix(opts.Suffix, ".go") || strings.HasSuffix(opts.Suffix, "_test.go") {
+		return nil, fmt.Errorf(`-suffix must end with ".go" but not with "_test.go", but got %q`, opts.Suffix)
+	}
+	if opts.Output == "" {
+		opts.Output = "{name}" + opts.Suffix
+	}
+	if opts.JSONPkg == "" {
+		opts.JSONPkg = "encoding/json"
+	}
+	if len(opts.Targets) == 0 {
+		opts.Targets = []string{"json"}
+	}
+	if opts.BSONPkg == "" {
+		opts.BSONPkg = "go.mongodb.org/mongo-driver/v2/bson"
+	}
+	if opts.MsgpackPkg == "" {
+		opts.MsgpackPkg = "github.com/vmihailenco/msgpack/v5"
+	}
+	if opts.Mode == "" {
+		opts.Mode = "reflect"
+	}
+	if opts.Procs == 0 {
+		opts.Procs = runtime.GOMAXPROCS(0)
+	}
+
+	// The methods are generated in the order of the target names whichever
+	// order they are given in.
+	names := append([]string(nil), opts.Targets...)
+	sort.Strings(names)
+	opts.Targets = names[:0]
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			opts.Targets = append(opts.Targets, name)
+		}
+	}
+
+	g := &Generator{opts: opts, fileOptions: fileOptions{header: opts.Header}}
+	var hasJSON, hasString bool
+	for _, name := range opts.Targets {
+		t, ok := targets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown -target %q", name)
+		}
+		if name == "json" && opts.Mode == "direct" {
+			t = directJSON
+		}
+		if name == "json" && len(opts.Templates) > 0 {
+			if opts.Mode == "direct" {
+				return nil, errors.New("-template-dir requires -mode=reflect")
+			}
+			var err error
+			if t, err = overrideTemplates(t, opts.Templates); err != nil {
+				return nil, fmt.Errorf("-template-dir: %v", err)
+			}
+		}
+		g.targets = append(g.targets, t)
+		hasJSON = hasJSON || name == "json"
+		hasString = hasString || name == "string"
+	}
+	if opts.Mode != "reflect" && opts.Mode != "direct" {
+		return nil, fmt.Errorf("unknown -mode %q", opts.Mode)
+	}
+	if err := checkNaming(opts.Naming); err != nil {
+		return nil, err
+	}
+	if _, err := receiverName(opts.Receiver, "T"); err != nil {
+		return nil, fmt.Errorf("-receiver: %v", err)
+	}
+	if opts.Procs < 0 {
+		return nil, errors.New("-p must be positive")
+	}
+	if opts.SchemaOut != "" && !strings.Contains(opts.SchemaOut, "{name}") {
+		return nil, errors.New(`-schema-out must contain "{name}"`)
+	}
+	if g.hasTests() && !hasJSON {
+		return nil, errors.New("-gen-tests, -gen-benchmarks and -gen-fuzz require -target=json")
+	}
+	if len(opts.Templates) > 0 && !hasJSON {
+		return nil, errors.New("-template-dir requires -target=json")
+	}
+	if hasString && !hasJSON {
+		return nil, errors.New("-target=string requires -target=json")
+	}
+	if opts.BuildTags != "" {
+		var err error
+		g.tags, err = constraint.Parse("//go:build " + opts.BuildTags)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -buildtags: %v", err)
+		}
+	}
+	return g, nil
+}
+
+// Generate returns the files generated for pkgs, which are loaded with
+// LoadMode. The diagnostics are returned as a scanner.ErrorList, along
+// with the files of the other types.
+func Generate(pkgs []*packages.Package, opts Options) ([]File, error) {
+	g, err := New(opts)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		files []File
+		errs  scanner.ErrorList
+	)
+	for _, p := range pkgs {
+		if p.Types == nil || p.TypesInfo == nil || p.Syntax == nil {
+			return nil, fmt.Errorf("%s is not loaded with LoadMode", p.PkgPath)
+		}
+		if len(p.Errors) > 0 {
+			return nil, p.Errors[0]
+		}
+		fs, diags := g.Package(&Package{
+			Fset:      p.Fset,
+			Types:     p.Types,
+			TypesInfo: p.TypesInfo,
+			Syntax:    p.Syntax,
+			Dir:       PackageDir(p),
+		})
+		files = append(files, fs...)
+		for _, d := range diags {
+			errs.Add(p.Fset.Position(d.Pos), d.Message)
+		}
+	}
+	return files, errs.Err()
+}
+
+// PackageDir returns the directory of the GoFiles of p, or "" if p has
+// none.
+func PackageDir(p *packages.Package) string {
+	if len(p.GoFiles) == 0 {
+		return ""
+	}
+	return filepath.Dir(p.GoFiles[0])
+}
+
+// Package returns the files generated for pkg, and the diagnostics of the
+// types for which no file is generated.
+func (g *Generator) Package(pkg *Package) ([]File, []Diagnostic) {
+	var (
+		infos []*structInfo
+		diags []Diagnostic
+	)
+	r := reporter(func(d Diagnostic) {
+		diags = append(diags, d)
+	})
+	report := r.Reportf
+	for _, f := range pkg.Syntax {
+		for _, decl := range f.Decls {
+			ast.Inspect(decl, func(n ast.Node) bool {
+				gd, ok := n.(*ast.GenDecl)
+				if !ok || gd.Tok != token.TYPE {
+					return true
+				}
+				for _, spec := range gd.Specs {
+					ts := spec.(*ast.TypeSpec)
+					doc := ts.Doc
+					if doc == nil && !gd.Lparen.IsValid() {
+						doc = gd.Doc
+					}
+					si := g.generate(pkg, ts, doc, r)
+					switch {
+					case si == nil:
+					case gd != decl:
+						// Methods cannot be declared on the types in functions.
+						report(ts.Pos(), "cannot generate methods of %s declared in a function", ts.Name.Name)
+					default:
+						infos = append(infos, si)
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	// The files are generated in the order of the declarations whichever
+	// order pkg.Syntax is in.
+	sort.SliceStable(infos, func(i, j int) bool {
+		pi, pj := pkg.Fset.Position(infos[i].decl), pkg.Fset.Position(infos[j].decl)
+		if pi.Filename != pj.Filename {
+			return pi.Filename < pj.Filename
+		}
+		return pi.Offset < pj.Offset
+	})
+	if g.opts.Found != nil {
+		for _, si := range infos {
+			g.opts.Found(pkg.Fset.Position(si.decl), si.Receiver)
+		}
+	}
+
+	var files []File
+	failed := func(pos token.Pos, err error) {
+		report(pos, "failed to generate: %v", err)
+	}
+	if g.opts.SchemaOut != "" {
+		for _, si := range distinctFiles(infos, g.schemaFilename, report) {
+			if si.Value != nil || si.Enum != nil {
+				continue
+			}
+			src, err := schemaFile(si, infos)
+			if err != nil {
+				failed(si.decl, err)
+				continue
+			}
+			files = append(files, File{Name: g.schemaFilename(si), Content: src, Pos: si.decl})
+		}
+	}
+
+	if g.opts.OpenAPIOut != "" && len(infos) > 0 {
+		if src, err := openAPIFile(infos); err != nil {
+			failed(infos[0].decl, err)
+		} else {
+			files = append(files, File{Name: infos[0].resolve(g.opts.OpenAPIOut), Content: src, Pos: infos[0].decl})
+		}
+	}
+
+	if g.opts.TSOut != "" && len(infos) > 0 {
+		if src, err := typeScriptFile(infos); err != nil {
+			failed(infos[0].decl, err)
+		} else {
+			files = append(files, File{Name: infos[0].resolve(g.opts.TSOut), Content: src, Pos: infos[0].decl})
+		}
+	}
+
+	if g.opts.SingleFile != "" {
+		if len(infos) > 0 {
+			fs, err := g.files(infos[0].resolve(g.opts.SingleFile), infos)
+			if err != nil {
+				failed(infos[0].decl, err)
+			}
+			files = append(files, fs...)
+		}
+		files = dropInvalid(pkg, files, failed)
+		return files, diags
+	}
+	infos = distinctFiles(infos, (*structInfo).Filename, report)
+	generated := make([][]File, len(infos))
+	errs := make([]error, len(infos))
+	g.parallel(len(infos), func(i int) {
+		generated[i], errs[i] = g.files(infos[i].Filename(), []*structInfo{infos[i]})
+	})
+	for i, err := range errs {
+		if err != nil {
+			failed(infos[i].decl, err)
+		}
+		files = append(files, generated[i]...)
+	}
+	files = dropInvalid(pkg, files, failed)
+	return files, diags
+}
+
+// distinctFiles returns infos except those whose files by filename are of
+// the preceding ones, e.g. of Foo and foo, which are reported instead of
+// overwriting each other.
+func distinctFiles(infos []*structInfo, filename func(*structInfo) string, report func(pos token.Pos, format string, args ...interface{})) []*structInfo {
+	var distinct []*structInfo
+	generatedBy := make(map[string]*structInfo)
+	for _, si := range infos {
+		name := filename(si)
+		if other, ok := generatedBy[name]; ok {
+			report(si.decl, "%s and %s are generated into the same file %s; rename either or use -single-file", other.Receiver, si.Receiver, name)
+			continue
+		}
+		generatedBy[name] = si
+		distinct = append(distinct, si)
+	}
+	return distinct
+}
+
+// schemaFilename returns the path of the JSON Schema of si.
+func (g *Generator) schemaFilename(si *structInfo) string {
+	return si.expand(g.opts.SchemaOut)
+}
+
+// parallel calls f with 0 <= i < n by up to Options.Procs goroutines.
+func (g *Generator) parallel(n int, f func(i int)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, g.opts.Procs)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			f(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// generate returns the structInfo of ts, or nil if there is nothing to
+// generate.
+func (g *Generator) generate(pkg *Package, ts *ast.TypeSpec, doc *ast.CommentGroup, r reporter) *structInfo {
+	if _, ok := findDirective(doc, "skip"); ok {
+		return nil
+	}
+	report := r.Reportf
+	si := newStructInfo(pkg.Fset, pkg.Types, ts, pkg.FileDir(ts.Pos()))
+	si.opts = &g.opts
+	si.typ = pkg.TypesInfo.Defs[ts.Name].Type()
+	if g.opts.Unchanged != nil {
+		src, err := declSource(pkg.Fset, ts, doc)
+		if err != nil {
+			report(ts.Pos(), "%v", err)
+			return nil
+		}
+		si.src = src
+	}
+	if f := fileOf(pkg, ts.Pos()); f != nil {
+		expr, err := buildConstraint(f)
+		if err != nil {
+			report(f.Pos(), "%v", err)
+			return nil
+		}
+		si.constraint = expr
+	}
+
+	pattern, ok := findDirective(doc, "receiver")
+	if !ok {
+		pattern = g.opts.Receiver
+	}
+	recv, err := receiverName(pattern, ts.Name.Name)
+	if err != nil {
+		report(ts.Pos(), "%v", err)
+		return nil
+	}
+	si.Recv = recv
+	if paths, ok := findDirective(doc, "import"); ok {
+		if err := si.addImports(paths); err != nil {
+			report(doc.Pos(), "%v", err)
+			return nil
+		}
+	}
+
+	s, ok := ts.Type.(*ast.StructType)
+	if !ok {
+		directive, ok := findDirective(doc, "marshal")
+		enum, isEnum := findDirective(doc, "enum")
+		switch {
+		case ok && isEnum:
+			report(doc.Pos(), "%s has both the encjsongen:marshal and encjsongen:enum directives", ts.Name.Name)
+			return nil
+		case !ok && !isEnum:
+			return nil
+		}
+		switch pkg.TypesInfo.TypeOf(ts.Type).Underlying().(type) {
+		case *types.Interface, *types.Pointer:
+			report(ts.Pos(), "cannot define methods on %s", ts.Name.Name)
+			return nil
+		}
+		if isEnum {
+			err = si.SetEnum(enum)
+		} else {
+			err = si.SetValue(directive)
+		}
+		if err != nil {
+			report(doc.Pos(), "%v", err)
+			return nil
+		}
+	} else {
+		rule := g.rule(pkg.Types.Path(), ts.Name.Name)
+		si.output = rule.Output
+		_, si.Strict = findDirective(doc, "strict")
+		si.Strict = si.Strict || g.opts.Strict || rule.Strict
+		_, si.Reset = findDirective(doc, "reset")
+		_, si.UseNumber = findDirective(doc, "usenumber")
+		si.UseNumber = si.UseNumber || g.opts.UseNumber || rule.UseNumber
+		if _, ok := findDirective(doc, "oneof"); ok {
+			if err := si.SetOneOf(); err != nil {
+				report(doc.Pos(), "%v", err)
+				return nil
+			}
+		}
+		directives, err := fieldDirectives(doc)
+		if err != nil {
+			report(doc.Pos(), "%v", err)
+			return nil
+		}
+		duplicated := false
+		for _, f := range s.Fields.List {
+			if d, ok := malformedTag(f, g.opts.Tag); ok {
+				r(d)
+				return nil
+			}
+			customjson := fieldTag(f).Get(g.opts.Tag)
+			names := f.Names
+			if len(names) == 0 {
+				names = []*ast.Ident{ast.NewIdent(embeddedName(f.Type))}
+			}
+			for _, name := range names {
+				tag := customjson
+				pos := f.Pos()
+				if d, ok := directives[name.Name]; ok {
+					if tag != "" {
+						r(Diagnostic{
+							Pos:     d.pos,
+							Message: fmt.Sprintf("%s has both a %s tag and an encjsongen:field directive", name.Name, g.opts.Tag),
+							Fix:     removeLineFix("Remove the directive", pkg.Fset, d.pos),
+						})
+						return nil
+					}
+					tag, pos = d.tag, d.pos
+					delete(directives, name.Name)
+				}
+				if tag == "" {
+					tag = rule.Fields[name.Name]
+				}
+				if tag == "" && len(f.Names) > 0 && name.IsExported() {
+					tag = g.mappedTag(rule, name.Name, f, pkg.TypesInfo.TypeOf(f.Type))
+				}
+				if tag == "" {
+					continue
+				}
+				if len(f.Names) == 0 {
+					if err := checkEmbedded(pkg.TypesInfo.TypeOf(f.Type)); err != nil {
+						report(pos, "%v", err)
+						return nil
+					}
+				}
+				if err := si.AddAlias(name.Name, pkg.TypesInfo.TypeOf(f.Type), tag); err != nil {
+					d := Diagnostic{Pos: pos, Message: err.Error()}
+					if tag == customjson {
+						d.Fix = optionsFix(f, g.opts.Tag)
+						e, _ := err.(*exprError)
+						d.Pos, d.End = tagRange(f, g.opts.Tag, e)
+					}
+					r(d)
+					return nil
+				}
+				if tag == customjson && len(f.Names) > 0 && name.IsExported() {
+					// All of them are reported to be fixed at once.
+					if d, ok := duplicateKey(f, name.Name, &si.Aliases[len(si.Aliases)-1]); ok {
+						r(d)
+						duplicated = true
+					}
+				}
+			}
+		}
+		if len(directives) > 0 {
+			names := make([]string, 0, len(directives))
+			for name := range directives {
+				names = append(names, name)
+			}
+			sort.Slice(names, func(i, j int) bool {
+				return directives[names[i]].pos < directives[names[j]].pos
+			})
+			for _, name := range names {
+				r(Diagnostic{
+					Pos:     directives[name].pos,
+					Message: fmt.Sprintf("%s has no field %s", ts.Name.Name, name),
+					Fix:     removeLineFix("Remove the directive", pkg.Fset, directives[name].pos),
+				})
+			}
+			return nil
+		}
+		if duplicated {
+			return nil
+		}
+		for _, d := range virtualDirectives(doc) {
+			if err := si.AddVirtual(d.tag); err != nil {
+				report(d.pos, "%v", err)
+				return nil
+			}
+		}
+		if err := si.checkInline(); err != nil {
+			report(ts.Pos(), "%s: %v", ts.Name.Name, err)
+			return nil
+		}
+		if si.OneOf != nil && len(si.Aliases) > 0 {
+			report(ts.Pos(), "%s has the encjsongen:oneof directive and converted fields", ts.Name.Name)
+			return nil
+		}
+	}
+	if !si.HasAlias() {
+		return nil
+	}
+	if ts.Assign.IsValid() {
+		r(aliasDiagnostic(pkg.Types, ts, si.typ))
+		return nil
+	}
+	if m := g.handWritten(pkg, si); m != nil {
+		pos := pkg.Fset.Position(m.Pos())
+		report(ts.Pos(), "%s has %s declared at %s:%d already; remove it or add the encjsongen:skip directive", ts.Name.Name, m.Name(), filepath.Base(pos.Filename), pos.Line)
+		return nil
+	}
+	if si.Enum != nil {
+		if obj := pkg.Types.Scope().Lookup(si.ParseFunc()); obj != nil {
+			if f := fileOf(pkg, obj.Pos()); f != nil && !isGenerated(f) {
+				report(ts.Pos(), "%s is declared already; remove it or add the encjsongen:skip directive", si.ParseFunc())
+				return nil
+			}
+		}
+	}
+	if si.BeforeMarshal, err = hasHook(si.typ, pkg.Types, "BeforeMarshalJSON"); err != nil {
+		report(ts.Pos(), "%v", err)
+		return nil
+	}
+	if si.AfterUnmarshal, err = hasHook(si.typ, pkg.Types, "AfterUnmarshalJSON"); err != nil {
+		report(ts.Pos(), "%v", err)
+		return nil
+	}
+	return si
+}
+
+// hasHook reports whether *t has the method name of func() error, which
+// the generated methods call.
+func hasHook(t types.Type, pkg *types.Package, name string) (bool, error) {
+	obj, _, _ := types.LookupFieldOrMethod(t, true, pkg, name)
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return false, nil
+	}
+	sig := fn.Type().(*types.Signature)
+	if sig.Params().Len() != 0 || sig.Results().Len() != 1 || !types.Identical(sig.Results().At(0).Type(), errorType) {
+		return false, fmt.Errorf("%s must be func() error", name)
+	}
+	return true, nil
+}
+
+// handWritten returns the method of si which a target would generate but
+// is declared outside the files generated by encjsongen, if any.
+func (g *Generator) handWritten(pkg *Package, si *structInfo) *types.Func {
+	named, ok := types.Unalias(si.typ).(*types.Named)
+	if !ok {
+		return nil
+	}
+	names := make(map[string]bool)
+	for _, t := range g.targets {
+		if t.accepts != nil && !t.accepts(si) {
+			continue
+		}
+		marshal, unmarshal := t.templates(si)
+		if si.HasMarshal() {
+			for _, name := range methodNames(marshal) {
+				names[name] = true
+			}
+		}
+		if si.HasUnmarshal() {
+			for _, name := range methodNames(unmarshal) {
+				names[name] = true
+			}
+		}
+	}
+	for i := 0; i < named.NumMethods(); i++ {
+		m := named.Method(i)
+		if !names[m.Name()] {
+			continue
+		}
+		if f := fileOf(pkg, m.Pos()); f != nil && !isGenerated(f) {
+			return m
+		}
+	}
+	return nil
+}
+
+// methodPattern matches the method declarations of the templates.
+var methodPattern = regexp.MustCompile(`(?m)^func \([^)]*\) (\w+)\(`)
+
+// methodNames returns the names of the methods declared by the template.
+func methodNames(tmpl string) []string {
+	var names []string
+	for _, m := range methodPattern.FindAllStringSubmatch(tmpl, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// isGenerated reports whether f is generated by encjsongen.
+func isGenerated(f *ast.File) bool {
+	for _, cg := range f.Comments {
+		if cg.Pos() > f.Package {
+			break
+		}
+		for _, c := range cg.List {
+			if c.Text == "// "+GeneratedMarker {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fileOf returns the file of pkg containing pos.
+func fileOf(pkg *Package, pos token.Pos) *ast.File {
+	tf := pkg.Fset.File(pos)
+	for _, f := range pkg.Syntax {
+		if pkg.Fset.File(f.Pos()) == tf {
+			return f
+		}
+	}
+	return nil
+}
+
+// buildConstraint returns the //go:build constraint of f, or nil if f has
+// none.
+func buildConstraint(f *ast.File) (constraint.Expr, error) {
+	for _, cg := range f.Comments {
+		if cg.Pos() > f.Package {
+			break
+		}
+		for _, c := range cg.List {
+			if constraint.IsGoBuild(c.Text) {
+				return constraint.Parse(c.Text)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// embeddedName returns the implicit field name of an embedded field of
+// type x.
+func embeddedName(x ast.Expr) string {
+	switch t := x.(type) {
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.IndexExpr:
+		return embeddedName(t.X)
+	case *ast.IndexListExpr:
+		return embeddedName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// checkEmbedded reports an error if the methods of the embedded type t
+// would be promoted to the alias struct and take over its encoding.
+func checkEmbedded(t types.Type) error {
+	if t == nil {
+		return errors.New("invalid embedded field")
+	}
+	if _, ok := t.(*types.Pointer); !ok {
+		t = types.NewPointer(t)
+	}
+	mset := types.NewMethodSet(t)
+	for _, name := range []string{"MarshalJSON", "UnmarshalJSON"} {
+		if mset.Lookup(nil, name) != nil {
+			return fmt.Errorf("cannot convert embedded %s: its %s would be promoted over the generated one", t.(*types.Pointer).Elem(), name)
+		}
+	}
+	return nil
+}
+
+// findDirective returns the argument of the "//encjsongen:<name>" comment
+// in doc.
+func findDirective(doc *ast.CommentGroup, name string) (string, bool) {
+	if doc == nil {
+		return "", false
+	}
+	prefix := "//encjsongen:" + name
+	for _, c := range doc.List {
+		if c.Text == prefix {
+			return "", true
+		}
+		if strings.HasPrefix(c.Text, prefix+" ") {
+			return strings.TrimSpace(c.Text[len(prefix):]), true
+		}
+	}
+	return "", false
+}
+
+// mappedTag returns the customjson tag of field name of f, of type t,
+// converted by the type mapping of rule or Options.TypeMap with the json
+// key kept, or "" if t is not mapped.
+func (g *Generator) mappedTag(rule Rule, name string, f *ast.Field, t types.Type) string {
+	typ := types.TypeString(t, nil)
+	conv, ok := rule.Types[typ]
+	if !ok {
+		conv, ok = g.opts.TypeMap[typ]
+	}
+	if !ok {
+		return ""
+	}
+	jsonTag := fieldTag(f).Get("json")
+	if jsonTag == "-" {
+		return ""
+	}
+	key, opts, _ := strings.Cut(jsonTag, ",")
+	if key == "" {
+		key = name
+	}
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == "omitempty" {
+			key += ",omitempty"
+		}
+	}
+	return key + "=" + conv
+}
+
+// fieldTag returns the tag of f, which is empty if f has none.
+func fieldTag(f *ast.Field) reflect.StructTag {
+	if f.Tag == nil {
+		return ""
+	}
+	tag, err := strconv.Unquote(f.Tag.Value)
+	if err != nil {
+		return ""
+	}
+	return reflect.StructTag(tag)
+}
+
+// fieldDirective is a "//encjsongen:field FIELD TAG" comment, where TAG is
+// the content of a customjson tag of FIELD, for structs whose tags cannot
+// be modified, or a "//encjsongen:virtual TAG" comment of no field.
+type fieldDirective struct {
+	pos token.Pos
+	tag string
+}
+
+// fieldDirectives returns the encjsongen:field directives in doc by FIELD.
+func fieldDirectives(doc *ast.CommentGroup) (map[string]fieldDirective, error) {
+	directives := make(map[string]fieldDirective)
+	if doc == nil {
+		return directives, nil
+	}
+	const prefix = "//encjsongen:field"
+	for _, c := range doc.List {
+		if c.Text != prefix && !strings.HasPrefix(c.Text, prefix+" ") {
+			continue
+		}
+		arg := strings.TrimSpace(c.Text[len(prefix):])
+		i := strings.IndexAny(arg, " \t")
+		if i < 0 {
+			return nil, errors.New("encjsongen:field requires a field name and a customjson tag")
+		}
+		name := arg[:i]
+		if _, ok := directives[name]; ok {
+			return nil, fmt.Errorf("duplicate encjsongen:field directives of %s", name)
+		}
+		directives[name] = fieldDirective{pos: c.Pos(), tag: strings.TrimSpace(arg[i:])}
+	}
+	return directives, nil
+}
+
+// virtualDirectives returns the encjsongen:virtual directives in doc in
+// order.
+func virtualDirectives(doc *ast.CommentGroup) []fieldDirective {
+	if doc == nil {
+		return nil
+	}
+	const prefix = "//encjsongen:virtual"
+	var directives []fieldDirective
+	for _, c := range doc.List {
+		if c.Text == prefix || strings.HasPrefix(c.Text, prefix+" ") {
+			directives = append(directives, fieldDirective{pos: c.Pos(), tag: strings.TrimSpace(c.Text[len(prefix):])})
+		}
+	}
+	return directives
+}
+
+type alias struct {
+	Target    string
+	Field     string // of the alias struct, exported even if Target is not
+	JSONKey   string
+	Type      string
+	Expr      string
+	ExprErr   bool
+	Assign    string
+	AssignErr bool
+	Kind      string // element-wise conversion if not empty
+	FieldType string
+	Required  bool   // whether UnmarshalJSON fails without the key
+	Default   string // assigned to the field if the key is missing or null
+	Validate  string // condition of the field after UnmarshalJSON
+	OmitIf    string // condition of the field under which the key is not marshaled
+
+	UsesContext bool // whether Expr refers to ctx
+
+	// Element types of Type and FieldType for pointers.
+	ElemType      string
+	FieldElemType string
+
+	fieldType   types.Type
+	aliasType   types.Type // of Type
+	validateSrc string     // Validate before "$" is substituted
+	exprSrc     string     // Expr before "$" is substituted
+	inline      string     // the struct type embedded for the inline option
+	sample      string     // of the field for the tests, if sampleValue would not survive a round trip
+	path        string     // imported by the generated file for a preset
+	union       []unionCase
+	targets     []string // the fields set by ASSIGN if it is an assignment
+	virtual     bool     // of the encjsongen:virtual directive, with no field
+}
+
+// aliasField returns the name of the field of the alias struct converting
+// the field name, e.g. AliasCreateTime for createTime. It is exported for
+// unexported fields to be encoded, unless the capitalized name is taken by
+// another field, in which case e.g. Alias_createTime is used.
+func (si *structInfo) aliasField(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	if unicode.IsUpper(r) {
+		return "Alias" + name
+	}
+	exported := string(unicode.ToUpper(r)) + name[size:]
+	if st, ok := si.typ.Underlying().(*types.Struct); ok {
+		for i := 0; i < st.NumFields(); i++ {
+			if st.Field(i).Name() == exported {
+				return "Alias_" + name
+			}
+		}
+	}
+	return "Alias" + exported
+}
+
+// value returns the value of the alias field marshaled, which Prepares
+// binds to a variable unless it is Expr.
+func (a alias) value() string {
+	if a.Kind != "" || a.ExprErr {
+		return "alias" + a.Target
+	}
+	return a.Expr
+}
+
+// MarshalType returns the type of the alias field marshaled, which is a
+// pointer left nil under the omitif condition.
+func (a alias) MarshalType() string {
+	if a.OmitIf != "" {
+		return "*" + a.Type
+	}
+	return a.Type
+}
+
+// MarshalKey returns the key of the alias field marshaled, with omitempty
+// for omitif.
+func (a alias) MarshalKey() string {
+	return a.omitKey(a.JSONKey)
+}
+
+// TargetKey returns the key of the alias field for the targets other than
+// json, without the options only the json tag has.
+func (a alias) TargetKey() string {
+	key, _ := cutOption(a.JSONKey, "string")
+	return key
+}
+
+// MarshalTargetKey is MarshalKey for the targets other than json.
+func (a alias) MarshalTargetKey() string {
+	return a.omitKey(a.TargetKey())
+}
+
+func (a alias) omitKey(key string) string {
+	if _, ok := cutOption(key, "omitempty"); a.OmitIf != "" && !ok {
+		return key + ",omitempty"
+	}
+	return key
+}
+
+// Key returns the JSON key without options.
+func (a alias) Key() string {
+	return keyName(a.JSONKey)
+}
+
+func keyName(name string) string {
+	if i := strings.Index(name, ","); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+func newStructInfo(fset *token.FileSet, pkg *types.Package, ts *ast.TypeSpec, dir string) *structInfo {
+	si := &structInfo{
+		fset:     fset,
+		pkg:      pkg,
+		decl:     ts.Pos(),
+		pos:      ts.Pos(),
+		path:     dir,
+		Receiver: ts.Name.Name,
+		Recv:     "v",
+	}
+	if ts.TypeParams != nil {
+		// Type parameters are only in scope within the type.
+		si.pos = ts.Type.Pos()
+		var names []string
+		for _, f := range ts.TypeParams.List {
+			for _, name := range f.Names {
+				names = append(names, name.Name)
+			}
+		}
+		si.TypeParams = "[" + strings.Join(names, ", ") + "]"
+	}
+	return si
+}
+
+type structInfo struct {
+	fset       *token.FileSet
+	pkg        *types.Package
+	decl       token.Pos // of the type name
+	pos        token.Pos // where expressions are evaluated
+	path       string
+	constraint constraint.Expr // of the source file
+	typ        types.Type      // the declared type
+	src        []byte          // of the declaration, for Options.Unchanged
+	opts       *Options
+	output     string // overrides Options.Output by the Config
+
+	imports  map[string]*types.Package // declared by import clauses and the encjsongen:import directive, by path
+	scopePos token.Pos                 // where expressions are evaluated with imports
+
+	Receiver   string
+	Recv       string // the receiver variable of the methods
+	TypeParams string // e.g. "[T, U]" for generic types
+	Aliases    []alias
+	Value      *alias       // set for named non-struct types instead of Aliases
+	OneOf      []oneOfField // set for struct types with the encjsongen:oneof directive
+	Enum       []enumValue  // set for integer types with the encjsongen:enum directive instead of Value
+	Strict     bool         // whether UnmarshalJSON rejects unknown keys
+	Reset      bool         // whether UnmarshalJSON zeroes the receiver first
+	UseNumber  bool         // whether UnmarshalJSON decodes the numbers of interface values as json.Number
+
+	BeforeMarshal  bool // whether MarshalJSON calls v.BeforeMarshalJSON()
+	AfterUnmarshal bool // whether UnmarshalJSON calls v.AfterUnmarshalJSON()
+}
+
+func (si *structInfo) AddAlias(name string, typ types.Type, tag string) error {
+	i := strings.Index(tag, "=")
+	if i < 0 {
+		return &exprError{What: "tag", Src: tag, Msg: fmt.Sprintf(`missing "=" between NAME and EXPR;ASSIGN, e.g. %s:"%s"`, si.opts.Tag, tagExample)}
+	}
+
+	key := tag[:i]
+	_, inline := cutOption(key, "inline")
+	if inline && key != ",inline" {
+		return errors.New("inline requires no key nor other options")
+	}
+	if key == "" || key[0] == ',' {
+		key = namedKey(si.opts.Naming, name) + key
+	}
+	if err := validateName(key); err != nil {
+		return err
+	}
+	key, required := cutOption(key, "required")
+	for _, a := range si.Aliases {
+		if !inline && !a.Inline() && a.Key() == keyName(key) {
+			return fmt.Errorf("duplicate key %q", keyName(key))
+		}
+	}
+
+	conv, clauses, err := cutClauses(tag[i+1:])
+	if err != nil {
+		return err
+	}
+	if paths, ok := clauses["import"]; ok {
+		if err := si.addImports(paths); err != nil {
+			return err
+		}
+	}
+	var (
+		expr, assign, kind string
+		p                  *preset
+	)
+	switch {
+	case strings.HasPrefix(conv, "@"):
+		p, kind, err = lookupPreset(conv[1:], typ)
+	case isUnion(conv):
+		kind = kindUnion
+	default:
+		expr, assign, kind, err = splitConv(conv)
+	}
+	if err != nil {
+		return err
+	}
+	var targets []*types.Var
+	if assign != "" {
+		if targets, assign, err = si.assignTargets(assign, name); err != nil {
+			return err
+		}
+		if targets != nil && kind != "" {
+			return errors.New("ASSIGN setting fields requires no element-wise conversion")
+		}
+	}
+	aliasField := si.aliasField(name)
+	value := "(*new(" + si.Receiver + si.TypeParams + "))." + name
+	op := operand{
+		typ:       typ,
+		bind:      placeholder + " := " + value + "\n%s",
+		marshal:   si.Recv + "." + name,
+		unmarshal: "aux." + aliasField,
+		targets:   targets,
+	}
+	field := op
+	switch kind {
+	case kindSlice:
+		if _, ok := typ.Underlying().(*types.Slice); !ok {
+			return fmt.Errorf("[](...) requires a slice field, but %s is %s", name, si.typeString(typ))
+		}
+		op = operand{
+			typ:       typ.Underlying().(*types.Slice).Elem(),
+			bind:      "for _, " + placeholder + " := range " + value + " {\n%s\n}",
+			marshal:   "e",
+			unmarshal: "e",
+		}
+	case kindMap:
+		m, ok := typ.Underlying().(*types.Map)
+		if !ok {
+			return fmt.Errorf("map[](...) requires a map field, but %s is %s", name, si.typeString(typ))
+		}
+		op = operand{
+			typ:       m.Elem(),
+			bind:      "for _, " + placeholder + " := range " + value + " {\n%s\n}",
+			marshal:   "e",
+			unmarshal: "e",
+		}
+	case kindPtr:
+		if _, ok := typ.Underlying().(*types.Pointer); !ok {
+			return fmt.Errorf("*(...) requires a pointer field, but %s is %s", name, si.typeString(typ))
+		}
+		op = operand{
+			typ:       typ.Underlying().(*types.Pointer).Elem(),
+			bind:      placeholder + " := *" + value + "\n%s",
+			marshal:   "(*" + si.Recv + "." + name + ")",
+			unmarshal: "(*aux." + aliasField + ")",
+		}
+	}
+
+	var a alias
+	switch {
+	case p != nil:
+		a = p.alias(op)
+	case kind == kindUnion:
+		if a, err = si.parseUnion(conv, typ); err != nil {
+			return err
+		}
+	default:
+		if a, err = si.parseConv(expr, assign, op); err != nil {
+			return err
+		}
+	}
+	for _, t := range targets {
+		a.targets = append(a.targets, t.Name())
+	}
+	if def, ok := clauses["default"]; ok {
+		if a.Assign == "" {
+			return errors.New("default requires ASSIGN")
+		}
+		if a.targets != nil {
+			return errors.New("default requires ASSIGN of the field itself")
+		}
+		if err := si.checkDefault(def, typ); err != nil {
+			return err
+		}
+		a.Default = literal(def)
+	}
+	if cond, ok := clauses["validate"]; ok {
+		if a.Assign == "" {
+			return errors.New("validate requires ASSIGN")
+		}
+		if err := si.checkCondition("validate", cond, field); err != nil {
+			return err
+		}
+		a.Validate = substituteFields(cond, field.marshal, si.Recv)
+		a.validateSrc = literal(cond)
+	}
+	if cond, ok := clauses["omitif"]; ok {
+		if a.Expr == "" {
+			return errors.New("omitif requires EXPR")
+		}
+		if err := si.checkCondition("omitif", cond, field); err != nil {
+			return err
+		}
+		a.OmitIf = substituteFields(cond, field.marshal, si.Recv)
+	}
+	a.Target = name
+	a.Field = aliasField
+	a.JSONKey = key
+	a.Required = required
+	a.Kind = kind
+	a.FieldType = si.typeString(typ)
+	a.fieldType = typ
+	switch kind {
+	case kindSlice:
+		a.Type = "[]" + a.Type
+		a.aliasType = types.NewSlice(a.aliasType)
+	case kindMap:
+		key := typ.Underlying().(*types.Map).Key()
+		a.Type = "map[" + si.typeString(key) + "]" + a.Type
+		a.aliasType = types.NewMap(key, a.aliasType)
+	case kindPtr:
+		a.ElemType = a.Type
+		a.Type = "*" + a.Type
+		a.aliasType = types.NewPointer(a.aliasType)
+		a.FieldElemType = si.typeString(typ.Underlying().(*types.Pointer).Elem())
+	}
+	if strings.Contains(key, ",string") && !quotable(a.aliasType) {
+		return fmt.Errorf("string option requires EXPR and ASSIGN of a string, number or boolean, but they are of %s", a.Type)
+	}
+	if inline {
+		if err := si.setInline(&a, clauses); err != nil {
+			return err
+		}
+	}
+	si.Aliases = append(si.Aliases, a)
+	return nil
+}
+
+// AddVirtual adds the key of the encjsongen:virtual directive "KEY=EXPR",
+// which has no field but is marshaled from EXPR of the receiver "$", e.g.
+// type="user" or _links=links($ID). UnmarshalJSON ignores the key.
+func (si *structInfo) AddVirtual(tag string) error {
+	key, conv, ok := strings.Cut(tag, "=")
+	if !ok || key == "" || key[0] == ',' {
+		return &exprError{What: "tag", Src: tag, Msg: `missing KEY=EXPR, e.g. //encjsongen:virtual type="user"`}
+	}
+	if err := validateName(key); err != nil {
+		return err
+	}
+	for _, opt := range []string{"inline", "required"} {
+		if _, ok := cutOption(key, opt); ok {
+			return fmt.Errorf("encjsongen:virtual does not support the %s option", opt)
+		}
+	}
+	for _, a := range si.Aliases {
+		if !a.Inline() && a.Key() == keyName(key) {
+			return fmt.Errorf("duplicate key %q", keyName(key))
+		}
+	}
+	if si.Strict && si.HasUnmarshal() {
+		return fmt.Errorf("encjsongen:virtual key %q would be rejected by UnmarshalJSON of the strict type", keyName(key))
+	}
+
+	conv, clauses, err := cutClauses(conv)
+	if err != nil {
+		return err
+	}
+	for name := range clauses {
+		if name != "omitif" && name != "import" {
+			return fmt.Errorf("encjsongen:virtual does not support %s", name)
+		}
+	}
+	if paths, ok := clauses["import"]; ok {
+		if err := si.addImports(paths); err != nil {
+			return err
+		}
+	}
+	expr, assign, kind, err := splitConv(conv)
+	if err != nil {
+		return err
+	}
+	if assign != "" || kind != "" {
+		return errors.New("encjsongen:virtual requires EXPR alone, as the key is not unmarshaled")
+	}
+	op := operand{
+		typ:     si.typ,
+		bind:    placeholder + " := *new(" + si.Receiver + si.TypeParams + ")\n%s",
+		marshal: "(" + si.MarshalValue() + ")",
+	}
+	a, err := si.parseConv(expr, "", op)
+	if err != nil {
+		return err
+	}
+	if cond, ok := clauses["omitif"]; ok {
+		if err := si.checkCondition("omitif", cond, op); err != nil {
+			return err
+		}
+		a.OmitIf = substituteFields(cond, op.marshal, si.Recv)
+	}
+	var n int
+	for _, a := range si.Aliases {
+		if a.virtual {
+			n++
+		}
+	}
+	a.Target = fmt.Sprintf("virtual%d", n+1)
+	a.Field = si.aliasField(a.Target)
+	a.JSONKey = key
+	a.virtual = true
+	if strings.Contains(key, ",string") && !quotable(a.aliasType) {
+		return fmt.Errorf("string option requires EXPR of a string, number or boolean, but it is of %s", a.Type)
+	}
+	si.Aliases = append(si.Aliases, a)
+	return nil
+}
+
+// quotable reports whether the string option of encoding/json applies to
+// values of t.
+func quotable(t types.Type) bool {
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&(types.IsBoolean|types.IsNumeric|types.IsString) != 0 && b.Info()&types.IsComplex == 0
+}
+
+// SetValue makes si a named non-struct type converted as a whole by the
+// "EXPR;ASSIGN" of the encjsongen:marshal directive.
+func (si *structInfo) SetValue(directive string) error {
+	expr, assign, kind, err := splitConv(directive)
+	if err != nil {
+		return err
+	}
+	if kind != "" {
+		return errors.New("element-wise conversion is not supported for named types")
+	}
+	a, err := si.parseConv(expr, assign, operand{
+		typ:       si.typ,
+		bind:      placeholder + " := *new(" + si.Receiver + si.TypeParams + ")\n%s",
+		marshal:   "(" + si.MarshalValue() + ")",
+		unmarshal: "aux",
+	})
+	if err != nil {
+		return err
+	}
+	if a.UsesContext {
+		return errors.New("ctx is not supported for named types")
+	}
+	si.Value = &a
+	return nil
+}
+
+// operand is what "$" is converted to in each context.
+type operand struct {
+	typ       types.Type // of "$"
+	bind      string     // statements declaring placeholder as "$" around %s, for type checking
+	marshal   string     // in MarshalJSON
+	unmarshal string     // in UnmarshalJSON
+
+	targets []*types.Var // the fields ASSIGN sets, if it is an assignment
+}
+
+// Kinds of element-wise conversion.
+const (
+	kindSlice = "slice" // [](EXPR);[](ASSIGN)
+	kindMap   = "map"   // map[](EXPR);map[](ASSIGN)
+	kindPtr   = "ptr"   // *(EXPR);*(ASSIGN)
+)
+
+// clauseNames are the names of clauses which may follow the conversion.
+var clauseNames = map[string]bool{
+	"default":  true,
+	"validate": true,
+	"omitif":   true,
+	"import":   true,
+}
+
+// cutClauses strips the "NAME=VALUE" clauses following the conversion,
+// such as ";default=time.Now()", and returns them by name.
+func cutClauses(conv string) (string, map[string]string, error) {
+	parts := splitTag(conv, ';')
+	clauses := make(map[string]string)
+	n := len(parts)
+	for ; n > 1; n-- {
+		i := strings.Index(parts[n-1], "=")
+		if i < 0 || !clauseNames[parts[n-1][:i]] {
+			break
+		}
+		name := parts[n-1][:i]
+		if _, ok := clauses[name]; ok {
+			return "", nil, fmt.Errorf("duplicate %s", name)
+		}
+		clauses[name] = unescape(parts[n-1][i+1:])
+	}
+	return strings.Join(parts[:n], ";"), clauses, nil
+}
+
+// checkDefault type checks the default expression of a field of type typ.
+func (si *structInfo) checkDefault(def string, typ types.Type) error {
+	tv, err := types.Eval(si.fset, si.pkg, si.evalPos(), def)
+	if err != nil {
+		return fmt.Errorf("invalid default: %v", err)
+	}
+	if tv.Type == nil || !types.AssignableTo(tv.Type, typ) {
+		return fmt.Errorf("invalid default: %s is not assignable to %s", def, si.typeString(typ))
+	}
+	return nil
+}
+
+// checkCondition type checks the condition of the clause, in which "$" is
+// op.
+func (si *structInfo) checkCondition(clause, cond string, op operand) error {
+	t, err := si.checkExpr(clause, cond, op, "")
+	if err != nil {
+		return err
+	}
+	if b, ok := t.Underlying().(*types.Basic); !ok || b.Info()&types.IsBoolean == 0 {
+		return fmt.Errorf("invalid %s: %s is not a boolean", clause, cond)
+	}
+	return nil
+}
+
+// Examples of the syntax in the messages of the invalid tags.
+const (
+	tagExample  = "createTime=" + convExample
+	convExample = "$.Unix();time.Unix($, 0)"
+)
+
+// splitConv splits "EXPR;ASSIGN", where either side may be omitted, and
+// strips the element-wise wrapper which both sides must agree on.
+func splitConv(conv string) (expr, assign, kind string, err error) {
+	exprs := splitTag(conv, ';')
+	for i := range exprs {
+		exprs[i] = unescape(exprs[i])
+	}
+	if len(exprs) == 1 {
+		exprs = append(exprs, "")
+	}
+	if len(exprs) != 2 {
+		return "", "", "", &exprError{What: "tag", Src: conv, Msg: fmt.Sprintf(`%d parts separated by ";"; want EXPR;ASSIGN followed by the clauses, e.g. %s`, len(exprs), convExample)}
+	}
+	if exprs[0] == "" && exprs[1] == "" {
+		return "", "", "", &exprError{What: "tag", Src: conv, Msg: "EXPR and ASSIGN are both empty; want EXPR;ASSIGN, EXPR or ;ASSIGN, e.g. " + convExample}
+	}
+
+	kinds := make([]string, 2)
+	for i, e := range exprs {
+		switch {
+		case !strings.HasSuffix(e, ")"):
+		case strings.HasPrefix(e, "[]("):
+			kinds[i], exprs[i] = kindSlice, e[len("[]("):len(e)-1]
+		case strings.HasPrefix(e, "map[]("):
+			kinds[i], exprs[i] = kindMap, e[len("map[]("):len(e)-1]
+		case strings.HasPrefix(e, "*("):
+			kinds[i], exprs[i] = kindPtr, e[len("*("):len(e)-1]
+		}
+	}
+	switch {
+	case exprs[0] == "":
+		kind = kinds[1]
+	case exprs[1] == "":
+		kind = kinds[0]
+	case kinds[0] != kinds[1]:
+		return "", "", "", &exprError{What: "tag", Src: conv, Msg: "EXPR and ASSIGN must both be element-wise or not, e.g. []($.Unix());[](time.Unix($, 0))"}
+	default:
+		kind = kinds[0]
+	}
+	return exprs[0], exprs[1], kind, nil
+}
+
+// parseConv type checks EXPR and ASSIGN, either of which may be empty, and
+// substitutes "$" in them by op.
+func (si *structInfo) parseConv(expr, assign string, op operand) (alias, error) {
+	var (
+		a       alias
+		ctxType string
+		err     error
+	)
+	if expr, err = si.funcRef("expr", expr, op.typ); err != nil {
+		return a, err
+	}
+	if expr != "" {
+		if usesIdent(expr, "ctx") {
+			if ctxType, err = si.contextType(); err != nil {
+				return a, err
+			}
+			a.UsesContext = true
+		}
+		typ, err := si.checkExpr("expr", expr, op, ctxType)
+		if err != nil {
+			return a, err
+		}
+		t, withErr, err := resultType(typ)
+		if err != nil {
+			return a, err
+		}
+		a.Type = si.typeString(t)
+		a.aliasType = t
+		a.Expr = substituteFields(expr, op.marshal, si.Recv)
+		a.exprSrc = expr
+		a.ExprErr = withErr
+	}
+	if assign, err = si.funcRef("assign", assign, a.aliasType); err != nil {
+		return a, err
+	}
+	if assign != "" {
+		call, err := si.parseAssign(assign)
+		if err != nil {
+			return a, err
+		}
+		if a.Type == "" {
+			t, err := call.operandType()
+			if err != nil {
+				return a, err
+			}
+			a.Type = si.typeString(t)
+			a.aliasType = t
+		}
+		a.Assign = substituteFields(assign, op.unmarshal, si.Recv)
+		if a.AssignErr, err = si.checkAssign(assign, expr, a.ExprErr, ctxType, call, op); err != nil {
+			return a, err
+		}
+	}
+	return a, nil
+}
+
+// typeString returns t as written in the generated file, whose imports
+// are resolved by package name.
+func (si *structInfo) typeString(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string {
+		if p == si.pkg {
+			return ""
+		}
+		return p.Name()
+	})
+}
+
+// contextType returns context.Context as written in the file of si, for
+// EXPR referring to ctx.
+func (si *structInfo) contextType() (string, error) {
+	for scope := si.pkg.Scope().Innermost(si.evalPos()); scope != nil; scope = scope.Parent() {
+		for _, name := range scope.Names() {
+			if pn, ok := scope.Lookup(name).(*types.PkgName); ok && pn.Imported().Path() == "context" {
+				return name + ".Context", nil
+			}
+		}
+	}
+	return "", errors.New(`EXPR referring to ctx requires the file to import "context"`)
+}
+
+// usesIdent reports whether expr refers to the identifier name, which is
+// not a selector.
+func usesIdent(expr, name string) bool {
+	return replaceIdent(expr, name, "") != expr
+}
+
+// replaceIdent replaces the identifier name in expr, except selectors, by
+// repl.
+func replaceIdent(expr, name, repl string) string {
+	var (
+		s    scanner.Scanner
+		b    strings.Builder
+		last int
+		prev token.Token
+	)
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", -1, len(expr)), []byte(expr), nil, 0)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.IDENT && lit == name && prev != token.PERIOD {
+			off := fset.Position(pos).Offset
+			b.WriteString(expr[last:off])
+			b.WriteString(repl)
+			last = off + len(name)
+		}
+		prev = tok
+	}
+	b.WriteString(expr[last:])
+	return b.String()
+}
+
+const placeholder = "encjsongen__"
+
+// assignCall holds what can be known about ASSIGN before "$" is bound.
+// Only the called function is evaluated, since the operand "$" has no
+// type until it is substituted.
+type assignCall struct {
+	call *ast.CallExpr
+	sig  *types.Signature // nil unless ASSIGN calls a function not depending on "$"
+}
+
+func (si *structInfo) parseAssign(assign string) (*assignCall, error) {
+	src := bindOperand(assign, placeholder)
+	e, err := parser.ParseExpr(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid assign: %v", err)
+	}
+	ac := &assignCall{}
+	call, ok := e.(*ast.CallExpr)
+	if !ok {
+		return ac, nil
+	}
+	ac.call = call
+	fun := src[call.Fun.Pos()-1 : call.Fun.End()-1]
+	if strings.Contains(fun, placeholder) {
+		return ac, nil
+	}
+	typ, err := types.Eval(si.fset, si.pkg, si.evalPos(), fun)
+	if err != nil {
+		return nil, err
+	}
+	ac.sig, _ = typ.Type.(*types.Signature)
+	return ac, nil
+}
+
+// operandType infers the alias type from the parameter which "$" is
+// passed to, for tags without EXPR.
+func (ac *assignCall) operandType() (types.Type, error) {
+	if ac.sig != nil {
+		params := ac.sig.Params()
+		for i, arg := range ac.call.Args {
+			if id, ok := arg.(*ast.Ident); !ok || id.Name != placeholder {
+				continue
+			}
+			if ac.sig.Variadic() && i >= params.Len()-1 {
+				return params.At(params.Len() - 1).Type().(*types.Slice).Elem(), nil
+			}
+			return params.At(i).Type(), nil
+		}
+	}
+	return nil, errors.New("cannot infer alias type: ASSIGN must pass $ to a function if EXPR is omitted")
+}
+
+var errorType = types.Universe.Lookup("error").Type()
+
+// resultType returns the value type of an expression which is either
+// single-valued or returns (T, error). withErr reports the latter.
+func resultType(t types.Type) (typ types.Type, withErr bool, err error) {
+	tuple, ok := t.(*types.Tuple)
+	if !ok {
+		return t, false, nil
+	}
+	if tuple.Len() != 2 || !types.Identical(tuple.At(1).Type(), errorType) {
+		return nil, false, errors.New("invalid expr: must return T or (T, error)")
+	}
+	return tuple.At(0).Type(), true, nil
+}
+
+// validateName checks the NAME segment, which is a JSON key optionally
+// followed by comma-separated options in the same form as the json tag,
+// which are copied to the alias field, "required" and "inline".
+func validateName(name string) error {
+	opts := strings.Split(name, ",")
+	if opts[0] == "" {
+		return &exprError{What: "tag", Src: name, Msg: "missing the key of NAME, e.g. createTime,omitempty"}
+	}
+	for _, opt := range opts[1:] {
+		if !nameOptions[opt] {
+			return &exprError{What: "tag", Src: "," + opt, Offset: 1, Msg: fmt.Sprintf("unsupported option %q; want %s", opt, optionList())}
+		}
+	}
+	return nil
+}
+
+// optionList returns the names of nameOptions for the messages.
+func optionList() string {
+	names := make([]string, 0, len(nameOptions))
+	for name := range nameOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// nameOptions are the options supported in the NAME segment.
+var nameOptions = map[string]bool{
+	"omitempty": true,
+	"string":    true,
+	"required":  true,
+	"inline":    true,
+}
+
+// cutOption returns name without the option opt, and whether it had opt.
+func cutOption(name, opt string) (string, bool) {
+	opts := strings.Split(name, ",")
+	for i := 1; i < len(opts); i++ {
+		if opts[i] == opt {
+			return strings.Join(append(opts[:i:i], opts[i+1:]...), ","), true
+		}
+	}
+	return name, false
+}
+
+func (si *structInfo) HasAlias() bool {
+	return len(si.Aliases) > 0 || si.Value != nil || si.OneOf != nil || si.Enum != nil
+}
+
+// HasMarshal reports whether any alias has EXPR.
+func (si *structInfo) HasMarshal() bool {
+	if si.Value != nil {
+		return si.Value.Expr != ""
+	}
+	if si.OneOf != nil || si.Enum != nil {
+		return true
+	}
+	for _, a := range si.Aliases {
+		if a.Expr != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasUnmarshal reports whether any alias has ASSIGN.
+func (si *structInfo) HasUnmarshal() bool {
+	if si.Value != nil {
+		return si.Value.Assign != ""
+	}
+	if si.OneOf != nil || si.Enum != nil {
+		return true
+	}
+	for _, a := range si.Aliases {
+		if a.Assign != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// files returns the file of the methods of infos, which belong to the same
+// package, with the build constraint of their source file, followed by the
+// file of their tests if any. No file is returned if no target applies to
+// infos, or with Options.Unchanged if filename is up to date.
+func (g *Generator) files(filename string, infos []*structInfo) ([]File, error) {
+	var hash string
+	if g.opts.Unchanged != nil {
+		hash = g.inputHash(infos)
+		ok, err := g.opts.Unchanged(filename, hash)
+		if err != nil || ok {
+			return nil, err
+		}
+	}
+	src, err := g.file(filename, infos)
+	if err != nil || src == nil {
+		return nil, err
+	}
+	files := []File{{Name: filename, Content: src, Pos: infos[0].decl, Hash: hash}}
+	if g.hasTests() {
+		filename = testFilename(filename)
+		src, err := g.tests(filename, infos)
+		if err != nil {
+			return nil, err
+		}
+		if src != nil {
+			files = append(files, File{Name: filename, Content: src, Pos: infos[0].decl})
+		}
+	}
+	return files, nil
+}
+
+// file returns the source of filename generated for infos, or nil if no
+// target applies to them.
+func (g *Generator) file(filename string, infos []*structInfo) ([]byte, error) {
+	b := new(bytes.Buffer)
+	if err := writeHeader(b, infos, g.fileOptions); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, t := range g.targets {
+		for _, spec := range t.imports(&g.opts) {
+			if !seen[spec] {
+				seen[spec] = true
+				fmt.Fprintf(b, "import %s\n", spec)
+			}
+		}
+	}
+	for _, si := range infos {
+		for _, spec := range si.importSpecs() {
+			if !seen[spec] {
+				seen[spec] = true
+				fmt.Fprintf(b, "import %s\n", spec)
+			}
+		}
+	}
+	n := b.Len()
+	for _, si := range infos {
+		for _, t := range g.targets {
+			if err := si.Render(b, t); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if b.Len() == n {
+		return nil, nil
+	}
+	return g.format(filename, b.Bytes())
+}
+
+// localPrefix guards imports.LocalPrefix, so that the Generators of
+// different Options.LocalPrefix, or of the packages generated in parallel,
+// do not race.
+var localPrefix sync.Mutex
+
+// format formats src of filename by goimports, grouping the imports of
+// Options.LocalPrefix after the others, and then by gofumpt if
+// Options.Gofumpt.
+func (g *Generator) format(filename string, src []byte) ([]byte, error) {
+	// imports.Process has no option of the local prefix but the variable.
+	localPrefix.Lock()
+	imports.LocalPrefix = g.opts.LocalPrefix
+	src, err := imports.Process(filename, src, nil)
+	localPrefix.Unlock()
+	if err != nil || !g.opts.Gofumpt {
+		return src, err
+	}
+	return gofumpt.Source(src, gofumpt.Options{})
+}
+
+// GeneratedMarker is in the header of the generated source files, by which
+// they are told from hand-written ones.
+const GeneratedMarker = "Code generated by encjsongen. DO NOT EDIT."
+
+// writeHeader writes the lines preceding the imports of a file generated
+// for infos.
+func writeHeader(b *bytes.Buffer, infos []*structInfo, opts fileOptions) error {
+	expr := infos[0].constraint
+	for _, si := range infos[1:] {
+		if constraintString(si.constraint) != constraintString(expr) {
+			return fmt.Errorf("%s and %s are declared under different build constraints", infos[0].Receiver, si.Receiver)
+		}
+	}
+	switch {
+	case expr == nil:
+		expr = opts.tags
+	case opts.tags != nil:
+		expr = &constraint.AndExpr{X: expr, Y: opts.tags}
+	}
+
+	if len(opts.header) > 0 {
+		b.Write(bytes.TrimRight(opts.header, "\n"))
+		fmt.Fprintf(b, "\n\n")
+	}
+	fmt.Fprintf(b, "// %s\n\n", GeneratedMarker)
+	if expr != nil {
+		fmt.Fprintf(b, "//go:build %s\n\n", expr)
+	}
+	fmt.Fprintf(b, "package %s\n\n", infos[0].pkg.Name())
+	return nil
+}
+
+func constraintString(expr constraint.Expr) string {
+	if expr == nil {
+		return ""
+	}
+	return expr.String()
+}
+
+// MarshalReceiver returns the receiver type of the marshaling methods,
+// which is not a pointer with Options.ValueReceiver. The unmarshaling
+// methods always have pointer receivers.
+func (si *structInfo) MarshalReceiver() string {
+	if si.opts.ValueReceiver {
+		return si.Receiver + si.TypeParams
+	}
+	return "*" + si.Receiver + si.TypeParams
+}
+
+// MarshalPtr returns the receiver of the marshaling methods as a pointer.
+func (si *structInfo) MarshalPtr() string {
+	if si.opts.ValueReceiver {
+		return "&" + si.Recv
+	}
+	return si.Recv
+}
+
+// ValueReceiver reports whether the marshaling methods have value
+// receivers.
+func (si *structInfo) ValueReceiver() bool {
+	return si.opts.ValueReceiver
+}
+
+// MarshalValue returns the receiver of the marshaling methods as a value.
+func (si *structInfo) MarshalValue() string {
+	if si.opts.ValueReceiver {
+		return si.Recv
+	}
+	return "*" + si.Recv
+}
+
+// MarshalPool returns the package-level sync.Pool of the alias structs of
+// MarshalJSON of -mode=reflect, so that they are not allocated by each
+// call. They are zeroed before being put back, so that the pool does not
+// keep the receivers alive. Generic types have none, as the alias structs
+// of their instantiations are of different types, and allocate them.
+//
+// The pool is named after the type name as it is, since the types of the
+// same name but the case of the first letter, e.g. foo and Foo, may be in
+// the same file.
+func (si *structInfo) MarshalPool() string {
+	if si.TypeParams != "" {
+		return ""
+	}
+	return "marshalPool" + si.Receiver
+}
+
+// Render writes the methods of si for t to b.
+func (si *structInfo) Render(b *bytes.Buffer, t *target) error {
+	if t.accepts != nil && !t.accepts(si) {
+		return nil
+	}
+	marshal, unmarshal := t.templates(si)
+	if si.HasMarshal() && marshal != "" {
+		if err := template.Must(template.New("marshal").Parse(marshal)).Execute(b, si); err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "\n")
+	}
+	if si.HasUnmarshal() && unmarshal != "" {
+		if err := template.Must(template.New("unmarshal").Parse(unmarshal)).Execute(b, si); err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "\n")
+	}
+	return nil
+}
+
+// Filename returns the path of the generated file according to
+// Options.Output, or the Config.
+func (si *structInfo) Filename() string {
+	if si.output != "" {
+		return si.expand(si.output)
+	}
+	return si.expand(si.opts.Output)
+}
+
+// expand returns the path of pattern, in which "{name}" is replaced by the
+// lower-cased type name.
+func (si *structInfo) expand(pattern string) string {
+	return si.resolve(strings.Replace(pattern, "{name}", strings.ToLower(si.Receiver), -1))
+}
+
+// resolve returns name relative to the package directory unless it is
+// absolute.
+func (si *structInfo) resolve(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(si.path, name)
+}
+
+// Prepares returns statements computing the alias values which cannot be
+// written inline in the struct literal. ret is the statement returning an
+// error from the method.
+func (si *structInfo) Prepares(ret string) []string {
+	var stmts []string
+	for _, a := range si.Aliases {
+		if a.UsesContext {
+			stmts = append(stmts, "ctx := context.Background()")
+			break
+		}
+	}
+	return append(stmts, si.ContextPrepares(ret)...)
+}
+
+// ContextPrepares is Prepares for methods taking ctx.
+func (si *structInfo) ContextPrepares(ret string) []string {
+	var stmts []string
+	for _, a := range si.Aliases {
+		if a.Kind != "" && a.ExprErr {
+			stmts = append(stmts, "var err error")
+			break
+		}
+	}
+	for _, a := range si.Aliases {
+		if a.Expr == "" {
+			continue
+		}
+		switch a.Kind {
+		case kindSlice, kindMap:
+			idx := a.index()
+			stmts = append(stmts, fmt.Sprintf(`var alias%[1]s %[2]s
+if %[5]s.%[1]s != nil {
+alias%[1]s = make(%[2]s, len(%[5]s.%[1]s))
+for %[3]s, e := range %[5]s.%[1]s {
+%[4]s
+}
+}`, a.Target, a.Type, idx, setStmt("alias"+a.Target+"["+idx+"]", a.Expr, a.ExprErr, ret), si.Recv))
+		case kindUnion:
+			stmts = append(stmts, si.unionPrepare(a, ret))
+		case kindPtr:
+			stmts = append(stmts, fmt.Sprintf(`var alias%[1]s %[2]s
+if %[5]s.%[1]s != nil {
+alias%[1]s = new(%[3]s)
+%[4]s
+}`, a.Target, a.Type, a.ElemType, setStmt("*alias"+a.Target, a.Expr, a.ExprErr, ret), si.Recv))
+		default:
+			if a.ExprErr {
+				stmts = append(stmts, fmt.Sprintf("alias%s, err := %s\nif err != nil {\n%s\n}", a.Target, a.Expr, ret))
+			}
+		}
+		if a.OmitIf != "" {
+			stmts = append(stmts, fmt.Sprintf("var omit%[1]s *%[2]s\nif !(%[3]s) {\ne := %[4]s\nomit%[1]s = &e\n}", a.Target, a.Type, a.OmitIf, a.value()))
+		}
+	}
+	return stmts
+}
+
+// Exprs returns the alias fields of the struct literal marshaled.
+func (si *structInfo) Exprs() []string {
+	var exprs []string
+	for _, a := range si.Aliases {
+		switch {
+		case a.Expr == "":
+		case a.OmitIf != "":
+			exprs = append(exprs, fmt.Sprintf("%s: omit%s,", a.Field, a.Target))
+		default:
+			exprs = append(exprs, fmt.Sprintf("%s: %s,", a.Field, a.value()))
+		}
+	}
+	return exprs
+}
+
+func (si *structInfo) Assigns() []string {
+	return si.assigns(true)
+}
+
+// PlainAssigns is Assigns without the defaults, for the methods other than
+// UnmarshalJSON which do not look up the keys.
+func (si *structInfo) PlainAssigns() []string {
+	return si.assigns(false)
+}
+
+// assigns returns the statements setting the fields from aux, which
+// return the first error of ASSIGN, or, with the defaults if more than one
+// ASSIGN returns an error, collect those of all the fields to return them
+// joined at the end.
+func (si *structInfo) assigns(withDefault bool) []string {
+	var (
+		exprs []string
+		join  = withDefault && si.assignErrs() > 1
+	)
+	if join {
+		exprs = append(exprs, "var errs []error")
+	}
+	for _, a := range si.Aliases {
+		if a.Assign == "" {
+			continue
+		}
+		ret, elemRet := "return err", "return err"
+		if join {
+			ret = fmt.Sprintf("errs = append(errs, fmt.Errorf(%s, err))", si.unionFormat("invalid {key}: %w", a))
+			elemRet = fmt.Sprintf("errs = append(errs, fmt.Errorf(%s, %s, err))", si.unionFormat("invalid {key}[%v]: %w", a), a.index())
+		}
+		var stmt string
+		switch a.Kind {
+		case kindSlice, kindMap:
+			idx := a.index()
+			stmt = fmt.Sprintf(`%[6]s.%[1]s = nil
+if aux.%[5]s != nil {
+%[6]s.%[1]s = make(%[2]s, len(aux.%[5]s))
+for %[3]s, e := range aux.%[5]s {
+%[4]s
+}
+}`, a.Target, a.FieldType, idx, setStmt(si.Recv+"."+a.Target+"["+idx+"]", a.Assign, a.AssignErr, elemRet), a.Field, si.Recv)
+		case kindPtr:
+			stmt = fmt.Sprintf(`%[5]s.%[1]s = nil
+if aux.%[4]s != nil {
+%[5]s.%[1]s = new(%[2]s)
+%[3]s
+}`, a.Target, a.FieldElemType, setStmt("*"+si.Recv+"."+a.Target, a.Assign, a.AssignErr, ret), a.Field, si.Recv)
+		case kindUnion:
+			stmt = si.unionAssign(a)
+		default:
+			stmt = setStmt(si.assignee(a), a.Assign, a.AssignErr, ret)
+		}
+		switch {
+		case !withDefault:
+		case a.Default != "":
+			stmt = fmt.Sprintf("if raw, ok := keys[`%s`]; !ok || string(raw) == `null` {\n%s.%s = %s\n} else {\n%s\n}", a.Key(), si.Recv, a.Target, a.Default, stmt)
+		case a.assignsPresent():
+			stmt = fmt.Sprintf("if raw := keys[`%s`]; raw != nil && string(raw) != `null` {\n%s\n}", a.Key(), stmt)
+		}
+		exprs = append(exprs, stmt)
+	}
+	if join {
+		exprs = append(exprs, "if err := errors.Join(errs...); err != nil {\nreturn err\n}")
+	}
+	return exprs
+}
+
+// Validates returns statements returning an error from UnmarshalJSON if a
+// field does not satisfy the condition of its validate clause.
+func (si *structInfo) Validates() []string {
+	var stmts []string
+	for _, a := range si.Aliases {
+		if a.Validate == "" {
+			continue
+		}
+		msg := fmt.Sprintf("%s: invalid %s: %s is false", si.Receiver, a.Key(), a.validateSrc)
+		stmts = append(stmts, fmt.Sprintf("if !(%s) {\nreturn errors.New(%s)\n}", a.Validate, strconv.Quote(msg)))
+	}
+	return stmts
+}
+
+// NeedsKeys reports whether UnmarshalJSON looks up the keys of the input,
+// for required keys, defaults and ASSIGN returning an error.
+func (si *structInfo) NeedsKeys() bool {
+	return si.LookupKeys() != ""
+}
+
+// LookupKeys returns the keys looked up in the keys of the input by
+// UnmarshalJSON, as the elements of an array literal, e.g. "a", "b".
+// Those of the input equal to them under case-folding are found by them,
+// as encoding/json matches the keys to the fields.
+func (si *structInfo) LookupKeys() string {
+	var keys []string
+	for _, a := range si.Aliases {
+		if a.Assign != "" && (a.Required || a.Default != "" || a.assignsPresent()) {
+			keys = append(keys, strconv.Quote(a.Key()))
+		}
+	}
+	return strings.Join(keys, ", ")
+}
+
+// assignsPresent reports whether UnmarshalJSON runs ASSIGN of a only if
+// the key is present and not null, leaving the field as it is otherwise,
+// as ASSIGN returning an error may fail on the zero value of the alias,
+// e.g. strconv.ParseInt of "".
+func (a alias) assignsPresent() bool {
+	return a.AssignErr && a.Default == "" && a.Kind == "" && !a.Inline()
+}
+
+// index returns the loop variable for the index or key of an element-wise
+// conversion.
+func (a alias) index() string {
+	if a.Kind == kindMap {
+		return "k"
+	}
+	return "i"
+}
+
+// assignee returns the left-hand side of the statement setting the field of
+// a, or the fields of the assignment of ASSIGN.
+func (si *structInfo) assignee(a alias) string {
+	if a.targets == nil {
+		return si.Recv + "." + a.Target
+	}
+	lhs := make([]string, len(a.targets))
+	for i, t := range a.targets {
+		lhs[i] = si.Recv + "." + t
+	}
+	return strings.Join(lhs, ", ")
+}
+
+// setStmt returns a statement assigning rhs to lhs, which returns by ret
+// if rhs returns a non-nil error.
+func setStmt(lhs, rhs string, withErr bool, ret string) string {
+	if withErr {
+		return fmt.Sprintf("if %s, err = %s; err != nil {\n%s\n}", lhs, rhs, ret)
+	}
+	return fmt.Sprintf("%s = %s", lhs, rhs)
+}
+
+// Required returns the keys which UnmarshalJSON fails without.
+func (si *structInfo) Required() []string {
+	var keys []string
+	for _, a := range si.Aliases {
+		if a.Required && a.Assign != "" {
+			keys = append(keys, a.Key())
+		}
+	}
+	return keys
+}
+
+func (si *structInfo) AssignErr() bool {
+	return si.assignErrs() > 0
+}
+
+// assignErrs returns the number of the aliases whose ASSIGN returns an
+// error.
+func (si *structInfo) assignErrs() int {
+	var n int
+	for _, a := range si.Aliases {
+		if a.AssignErr {
+			n++
+		}
+	}
+	return n
+}
+
+const tmplMarshalJSON = `
+{{- with .MarshalPool }}var {{.}} sync.Pool
+
+{{ end -}}
+func ({{.Recv}} {{.MarshalReceiver}}) MarshalJSON() ([]byte, error) {
+	{{- if .BeforeMarshal }}
+	if err := {{.Recv}}.BeforeMarshalJSON(); err != nil {
+		return nil, err
+	}
+	{{- end }}
+	{{- range .Prepares "return nil, err" }}
+	{{.}}
+	{{- end }}
+	type Alias {{.Receiver}}{{.TypeParams}}
+	{{- range .InlineTypes true }}
+	{{.}}
+	{{- end }}
+	{{- if .MarshalPool }}
+	type Aux struct {
+		*Alias
+		{{- range .Aliases }}{{ if .Expr }}
+		{{.MarshalDecl}}
+		{{- end }}{{ end }}
+	}
+	aux, _ := {{.MarshalPool}}.Get().(*Aux)
+	if aux == nil {
+		aux = new(Aux)
+	}
+	*aux = Aux{
+		Alias: (*Alias)({{.MarshalPtr}}),
+		{{- range .Exprs }}
+		{{.}}
+		{{- end }}
+	}
+	b, err := json.Marshal(aux)
+	*aux = Aux{}
+	{{.MarshalPool}}.Put(aux)
+	return b, err
+	{{- else }}
+	return json.Marshal(&struct {
+		*Alias
+		{{- range .Aliases }}{{ if .Expr }}
+		{{.MarshalDecl}}
+		{{- end }}{{ end }}
+	}{
+		Alias: (*Alias)({{.MarshalPtr}}),
+		{{- range .Exprs }}
+		{{.}}
+		{{- end }}
+	})
+	{{- end }}
+}
+`
+
+// The decoder of the strict and usenumber types rejects the data after the
+// object, as json.Unmarshal does.
+const tmplUnmarshalJSON = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) UnmarshalJSON(b []byte) error {
+	{{- if .Reset }}
+	*{{.Recv}} = {{.Receiver}}{{.TypeParams}}{}
+	{{- end }}
+	type Alias {{.Receiver}}{{.TypeParams}}
+	{{- range .InlineTypes false }}
+	{{.}}
+	{{- end }}
+	aux := &struct {
+		*Alias
+		{{- range .Aliases }}{{ if .Assign }}
+		{{.UnmarshalDecl}}
+		{{- end }}{{ end }}
+	}{
+		Alias: (*Alias)({{.Recv}}),
+	}
+	{{- if or .Strict .UseNumber }}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	{{- if .Strict }}
+	dec.DisallowUnknownFields()
+	{{- end }}
+	{{- if .UseNumber }}
+	dec.UseNumber()
+	{{- end }}
+	if err := dec.Decode(aux); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			err = errors.New("json: invalid data after top-level value")
+		}
+		return err
+	}
+	{{- else }}
+	if err := json.Unmarshal(b, aux); err != nil {
+		return err
+	}
+	{{- end }}
+	{{- if .NeedsKeys }}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return err
+	}
+	for key, raw := range keys {
+		for _, name := range [...]string{ {{- .LookupKeys -}} } {
+			if _, ok := keys[name]; !ok && strings.EqualFold(key, name) {
+				keys[name] = raw
+			}
+		}
+	}
+	{{- end }}
+	{{- range .Required }}
+	if _, ok := keys["{{.}}"]; !ok {
+		return fmt.Errorf("{{$.Receiver}}: missing required key %q", "{{.}}")
+	}
+	{{- end }}
+	{{- if .AssignErr }}
+	var err error
+	{{- end }}
+	{{- range .Assigns }}
+	{{.}}
+	{{- end }}
+	{{- range .Validates }}
+	{{.}}
+	{{- end }}
+	{{- if .AfterUnmarshal }}
+	return {{.Recv}}.AfterUnmarshalJSON()
+	{{- else }}
+	return nil
+	{{- end }}
+}
+`
+
+const tmplMarshalNamed = `func ({{.Recv}} {{.MarshalReceiver}}) MarshalJSON() ([]byte, error) {
+	{{- if .BeforeMarshal }}
+	if err := {{.Recv}}.BeforeMarshalJSON(); err != nil {
+		return nil, err
+	}
+	{{- end }}
+	{{- with .Value }}{{ if .ExprErr }}
+	aux, err := {{.Expr}}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(aux)
+	{{- else }}
+	return json.Marshal({{.Expr}})
+	{{- end }}{{ end }}
+}
+`
+
+const tmplUnmarshalNamed = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) UnmarshalJSON(b []byte) error {
+	{{- with .Value }}
+	var aux {{.Type}}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	{{- if .AssignErr }}
+	var err error
+	if *{{$.Recv}}, err = {{.Assign}}; err != nil {
+		return err
+	}
+	{{- else }}
+	*{{$.Recv}} = {{.Assign}}
+	{{- end }}{{ end }}
+	{{- if .AfterUnmarshal }}
+	return {{.Recv}}.AfterUnmarshalJSON()
+	{{- else }}
+	return nil
+	{{- end }}
+}
+`
@@ -0,0 +1,379 @@
+package generator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// stubModule is a module of a single package, such as one required by a
+// preset, replaced by its source in the module of run.
+type stubModule struct {
+	path string
+	src  string
+}
+
+// run generates the methods of the types of src, the source of package
+// main, with opts, and returns the output of the program, whose main
+// function exercises them. It is run in a copy of the module, so that the
+// generated files may import the direct package, with stubs.
+func run(t *testing.T, src string, opts Options, stubs ...stubModule) string {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	root := t.TempDir()
+	mod := "module github.com/daisuzu/encjsongen\n\ngo 1.21\n"
+	for _, stub := range stubs {
+		dir := filepath.Join(root, "stubs", filepath.FromSlash(stub.path))
+		writeFile(t, filepath.Join(dir, "go.mod"), "module "+stub.path+"\n\ngo 1.21\n")
+		writeFile(t, filepath.Join(dir, "stub.go"), stub.src)
+		mod += fmt.Sprintf("\nrequire %[1]s v0.0.0\n\nreplace %[1]s => ./stubs/%[1]s\n", stub.path)
+	}
+	writeFile(t, filepath.Join(root, "go.mod"), mod)
+	direct, err := filepath.Glob(filepath.Join("..", "direct", "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range direct {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, filepath.Join(root, "direct", filepath.Base(name)), string(b))
+	}
+	dir := filepath.Join(root, "main")
+	files, diags := generate(t, filepath.Join(dir, "main.go"), src, opts)
+	for _, d := range diags {
+		t.Error(d)
+	}
+	if len(diags) > 0 {
+		t.FailNow()
+	}
+	writeFile(t, filepath.Join(dir, "main.go"), src)
+	for _, file := range files {
+		writeFile(t, file.Name, string(file.Content))
+	}
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=-mod=mod")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s", err, out)
+	}
+	return string(out)
+}
+
+// generate returns the files generated for src of filename with opts, and
+// the diagnostics of the types for which none is generated.
+func generate(t *testing.T, filename, src string, opts Options) ([]File, []string) {
+	t.Helper()
+	fset, files, diags := diagnose(t, filename, src, opts)
+	var msgs []string
+	for _, d := range diags {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", fset.Position(d.Pos), d.Message))
+	}
+	return files, msgs
+}
+
+// diagnose is generate returning the diagnostics as they are, with the
+// file set of their positions.
+func diagnose(t *testing.T, filename, src string, opts Options) (*token.FileSet, []File, []Diagnostic) {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Implicits:  make(map[ast.Node]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		Scopes:     make(map[ast.Node]*types.Scope),
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check("main", fset, []*ast.File{f}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, diags := g.Package(&Package{Fset: fset, Types: pkg, TypesInfo: info, Syntax: []*ast.File{f}, Dir: filepath.Dir(filename)})
+	return fset, files, diags
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMarshalPool(t *testing.T) {
+	const src = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type User struct {
+	Name       string    ` + "`json:\"name\"`" + `
+	CreateTime time.Time ` + "`json:\"-\" customjson:\"createTime=$.Unix();time.Unix($, 0)\"`" + `
+}
+
+// user shares the name of the pool of User but the case.
+type user struct {
+	Name string ` + "`json:\"-\" customjson:\"name=$;$\"`" + `
+}
+
+func main() {
+	v := &User{Name: "a", CreateTime: time.Unix(1, 0)}
+	m := interface{}(v).(json.Marshaler)
+	b, err := m.MarshalJSON()
+	fmt.Println(string(b), err)
+	b, err = json.Marshal(&user{Name: "b"})
+	fmt.Println(string(b), err)
+	// The alias struct allocated by each call.
+	type alias struct {
+		Name       string ` + "`json:\"name\"`" + `
+		CreateTime int64  ` + "`json:\"createTime\"`" + `
+	}
+	fmt.Println(testing.AllocsPerRun(100, func() {
+		m.MarshalJSON()
+	}) < testing.AllocsPerRun(100, func() {
+		json.Marshal(&alias{v.Name, v.CreateTime.Unix()})
+	}))
+}
+`
+	const want = `{"name":"a","createTime":1} <nil>
+{"name":"b"} <nil>
+true
+`
+	if got := run(t, src, Options{SingleFile: "json.go"}); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+// trailingSrc unmarshals S of the directive, converting T, from inputs
+// followed by data other than whitespace. UnmarshalJSON is called directly,
+// as json.Unmarshal rejects them before calling it.
+const trailingSrc = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+//encjsongen:%s
+type S struct {
+	T int ` + "`json:\"-\" customjson:\"t=$;$\"`" + `
+}
+
+func main() {
+	for _, in := range []string{
+		"{\"t\":1}",
+		"{\"t\":1} \n",
+		"{\"t\":1} garbage",
+		"{\"t\":1} {}",
+		"{\"t\":1}]",
+	} {
+		var s S
+		err := interface{}(&s).(json.Unmarshaler).UnmarshalJSON([]byte(in))
+		fmt.Println(s.T, err != nil)
+	}
+}
+`
+
+const trailingWant = `1 false
+1 false
+0 true
+0 true
+0 true
+`
+
+func TestStrictTrailingData(t *testing.T) {
+	if got := run(t, fmt.Sprintf(trailingSrc, "strict"), Options{}); got != trailingWant {
+		t.Errorf("got\n%s\nwant\n%s", got, trailingWant)
+	}
+}
+
+func TestUseNumberTrailingData(t *testing.T) {
+	if got := run(t, fmt.Sprintf(trailingSrc, "usenumber"), Options{}); got != trailingWant {
+		t.Errorf("got\n%s\nwant\n%s", got, trailingWant)
+	}
+}
+
+// absentSrc unmarshals inputs with and without the key n, converted by
+// ASSIGN returning an error, into T set beforehand.
+const absentSrc = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+type T struct {
+	N int ` + "`json:\"-\" customjson:\"n=strconv.Itoa($);strconv.Atoi($)\"`" + `
+}
+
+var _ = strconv.Atoi
+
+func main() {
+	for _, in := range []string{
+		"{}",
+		"{\"n\":null}",
+		"{\"n\":\"2\"}",
+	} {
+		v := T{N: 1}
+		err := json.Unmarshal([]byte(in), &v)
+		fmt.Println(v.N, err)
+	}
+}
+`
+
+func TestAssignErrAbsent(t *testing.T) {
+	const want = `1 <nil>
+1 <nil>
+2 <nil>
+`
+	for _, mode := range []string{"reflect", "direct"} {
+		if got := run(t, absentSrc, Options{Mode: mode}); got != want {
+			t.Errorf("-mode=%s: got\n%s\nwant\n%s", mode, got, want)
+		}
+	}
+}
+
+func TestRequiredFold(t *testing.T) {
+	const src = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type T struct {
+	A string ` + "`json:\"-\" customjson:\"a,required=$;$\"`" + `
+}
+
+func main() {
+	for _, in := range []string{
+		"{\"a\":\"1\"}",
+		"{\"A\":\"2\"}",
+		"{}",
+	} {
+		var v T
+		err := json.Unmarshal([]byte(in), &v)
+		fmt.Println(v.A, err)
+	}
+}
+`
+	const want = `1 <nil>
+2 <nil>
+ T: missing required key "a"
+`
+	for _, mode := range []string{"reflect", "direct"} {
+		if got := run(t, src, Options{Mode: mode}); got != want {
+			t.Errorf("-mode=%s: got\n%s\nwant\n%s", mode, got, want)
+		}
+	}
+}
+
+func TestDefaultFold(t *testing.T) {
+	const src = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type T struct {
+	B string ` + "`json:\"-\" customjson:\"b=$;$;default=\\\"d\\\"\"`" + `
+}
+
+func main() {
+	for _, in := range []string{
+		"{\"b\":\"1\"}",
+		"{\"B\":\"2\"}",
+		"{\"B\":null}",
+		"{}",
+	} {
+		var v T
+		err := json.Unmarshal([]byte(in), &v)
+		fmt.Println(v.B, err)
+	}
+}
+`
+	const want = `1 <nil>
+2 <nil>
+d <nil>
+d <nil>
+`
+	for _, mode := range []string{"reflect", "direct"} {
+		if got := run(t, src, Options{Mode: mode}); got != want {
+			t.Errorf("-mode=%s: got\n%s\nwant\n%s", mode, got, want)
+		}
+	}
+}
+
+func TestFormatLocalPrefix(t *testing.T) {
+	const src = `package p
+
+import (
+	"example.com/x"
+	"fmt"
+)
+
+var _, _ = fmt.Sprint, x.X
+`
+	want := map[string]string{
+		"":            "import (\n\t\"example.com/x\"\n\t\"fmt\"\n)",
+		"example.com": "import (\n\t\"fmt\"\n\n\t\"example.com/x\"\n)",
+	}
+	var wg sync.WaitGroup
+	for prefix, imports := range want {
+		g, err := New(Options{LocalPrefix: prefix})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(prefix, imports string) {
+				defer wg.Done()
+				b, err := g.format("p.go", []byte(src))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !strings.Contains(string(b), imports) {
+					t.Errorf("-local=%q: got\n%s\nwant\n%s", prefix, b, imports)
+				}
+			}(prefix, imports)
+		}
+	}
+	wg.Wait()
+}
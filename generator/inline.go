@@ -0,0 +1,134 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"go/types"
+)
+
+// setInline makes a embedded in the alias struct by the inline option, so
+// that encoding/json flattens the keys of its struct into the object.
+func (si *structInfo) setInline(a *alias, clauses map[string]string) error {
+	if a.Kind != "" {
+		return errors.New("inline does not support element-wise conversions")
+	}
+	for _, name := range []string{"default", "omitif"} {
+		if _, ok := clauses[name]; ok {
+			return fmt.Errorf("inline does not support %s", name)
+		}
+	}
+	t := a.aliasType
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	if _, ok := t.Underlying().(*types.Struct); !ok {
+		return fmt.Errorf("inline requires EXPR and ASSIGN of a struct or a pointer to one, but they are of %s", a.Type)
+	}
+	if err := checkEmbedded(a.aliasType); err != nil {
+		return err
+	}
+	a.inline = si.typeString(t)
+	return nil
+}
+
+// Inline reports whether a has the inline option.
+func (a alias) Inline() bool {
+	return a.inline != ""
+}
+
+// InlineTypes returns the declarations of the aliases of the struct types
+// embedded for the inline option, named after the alias fields, of the
+// methods marshaling if marshal or else unmarshaling.
+func (si *structInfo) InlineTypes(marshal bool) []string {
+	var decls []string
+	for _, a := range si.Aliases {
+		if a.Inline() && (marshal && a.Expr != "" || !marshal && a.Assign != "") {
+			decls = append(decls, fmt.Sprintf("type %s = %s", a.Field, a.inline))
+		}
+	}
+	return decls
+}
+
+// MarshalDecl returns the declaration of the alias field in the alias
+// struct marshaled by the json targets.
+func (a alias) MarshalDecl() string {
+	if a.Inline() {
+		return a.embedded()
+	}
+	return fmt.Sprintf("%s %s `json:\"%s\"`", a.Field, a.MarshalType(), a.MarshalKey())
+}
+
+// UnmarshalDecl is MarshalDecl for the alias struct unmarshaled.
+func (a alias) UnmarshalDecl() string {
+	if a.Inline() {
+		return a.embedded()
+	}
+	return fmt.Sprintf("%s %s `json:\"%s\"`", a.Field, a.Type, a.JSONKey)
+}
+
+// embedded returns the embedded field of the alias of InlineTypes.
+func (a alias) embedded() string {
+	if _, ok := a.aliasType.Underlying().(*types.Pointer); ok {
+		return "*" + a.Field
+	}
+	return a.Field
+}
+
+// inlineFields returns the fields of the struct of the inline a as
+// flattened into the alias struct, which are as deep as the ones of the
+// embedded *Alias.
+func (a *alias) inlineFields() []jsonField {
+	t := a.aliasType
+	p, ptr := t.Underlying().(*types.Pointer)
+	if ptr {
+		t = p.Elem()
+	}
+	fields := collectFields(nil, t.Underlying().(*types.Struct), nil)
+	for i := range fields {
+		fields[i].alias = a
+		// The keys are absent through the nil pointer.
+		fields[i].omitempty = fields[i].omitempty || ptr
+	}
+	return fields
+}
+
+// checkInline reports an error if a key flattened by the inline option is
+// also of another field as deep, of which encoding/json would silently
+// encode either or neither.
+func (si *structInfo) checkInline() error {
+	type owner struct {
+		name  string
+		depth int
+	}
+	converted := make(map[string]bool)
+	for _, a := range si.Aliases {
+		if !a.Inline() {
+			converted[a.Key()] = true
+		}
+	}
+	owners := make(map[string]owner)
+	for _, f := range collectFields(nil, si.typ.Underlying().(*types.Struct), nil) {
+		if o, ok := owners[f.key]; !ok || f.depth < o.depth {
+			owners[f.key] = owner{f.path[0].Name(), f.depth}
+		}
+	}
+	for i := range si.Aliases {
+		a := &si.Aliases[i]
+		if !a.Inline() {
+			continue
+		}
+		for _, f := range a.inlineFields() {
+			if converted[f.key] {
+				continue
+			}
+			o, ok := owners[f.key]
+			switch {
+			case !ok || f.depth < o.depth:
+				owners[f.key] = owner{a.Target, f.depth}
+			case f.depth == o.depth && o.name != a.Target:
+				return fmt.Errorf("key %q of the inline %s is also of %s", f.key, a.Target, o.name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package generator
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const inlineSrc = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type Point struct {
+	Lat float64 ` + "`json:\"lat\"`" + `
+	Lng float64 ` + "`json:\"lng\"`" + `
+}
+
+type Name struct {
+	First string ` + "`json:\"first\"`" + `
+	Last  string ` + "`json:\"last,omitempty\"`" + `
+}
+
+func toName(s string) *Name {
+	if s == "" {
+		return nil
+	}
+	first, last, _ := strings.Cut(s, " ")
+	return &Name{First: first, Last: last}
+}
+
+func fromName(n *Name) string {
+	if n == nil {
+		return ""
+	}
+	return strings.TrimSpace(n.First + " " + n.Last)
+}
+
+type Place struct {
+	ID       int
+	Location [2]float64 ` + "`json:\"-\" customjson:\",inline=Point{Lat: $[0], Lng: $[1]};[2]float64{$.Lat, $.Lng}\"`" + `
+	Owner    string     ` + "`json:\"-\" customjson:\",inline=toName($);fromName($)\"`" + `
+}
+
+func main() {
+	for _, v := range []Place{
+		{ID: 1, Location: [2]float64{35.6, 139.7}, Owner: "John Smith"},
+		{ID: 2},
+	} {
+		b, err := json.Marshal(&v)
+		fmt.Println(string(b), err)
+	}
+	for _, in := range []string{
+		"{\"ID\":1,\"lat\":35.6,\"lng\":139.7,\"first\":\"John\",\"last\":\"Smith\"}",
+		"{\"ID\":2,\"lat\":1}",
+	} {
+		var v Place
+		err := json.Unmarshal([]byte(in), &v)
+		fmt.Printf("%+v %v\n", v, err)
+	}
+}
+`
+
+func TestInline(t *testing.T) {
+	// The nil pointer of Owner adds no keys.
+	const want = `{"ID":1,"lat":35.6,"lng":139.7,"first":"John","last":"Smith"} <nil>
+{"ID":2,"lat":0,"lng":0} <nil>
+{ID:1 Location:[35.6 139.7] Owner:John Smith} <nil>
+{ID:2 Location:[1 0] Owner:} <nil>
+`
+	if got := run(t, inlineSrc, Options{}); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestInlineInvalid(t *testing.T) {
+	const src = `package main
+
+type Point struct {
+	Lat float64
+	Lng float64
+}
+
+type Place struct {
+	Location [2]float64 ` + "`%s customjson:\",inline=Point{Lat: $[0], Lng: $[1]};[2]float64{$.Lat, $.Lng}%s\"`" + `
+}
+`
+	for _, tt := range []struct {
+		name   string
+		json   string
+		clause string
+		opts   Options
+		want   string
+	}{
+		{name: "key", want: `Location is encoded under "Location" besides inline; add json:"-" to its tag`},
+		{name: "default", json: `json:"-"`, clause: ";default=[2]float64{}", want: "inline does not support default"},
+		{name: "direct", json: `json:"-"`, opts: Options{Mode: "direct"}, want: "-mode=direct does not support the inline option of Location"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "main.go")
+			_, diags := generate(t, filename, strings.Replace(strings.Replace(src, "%s", tt.json, 1), "%s", tt.clause, 1), tt.opts)
+			if len(diags) != 1 || !strings.Contains(diags[0], tt.want) {
+				t.Errorf("got %q, want %q", diags, tt.want)
+			}
+		})
+	}
+}
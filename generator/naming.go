@@ -0,0 +1,128 @@
+package generator
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// namings derive the JSON keys from the field names for Options.Naming.
+var namings = map[string]func(words []string) string{
+	"snake": func(words []string) string {
+		return strings.ToLower(strings.Join(words, "_"))
+	},
+	"kebab": func(words []string) string {
+		return strings.ToLower(strings.Join(words, "-"))
+	},
+	"camel": func(words []string) string {
+		for i, w := range words {
+			w = strings.ToLower(w)
+			if i > 0 {
+				w = strings.ToUpper(w[:1]) + w[1:]
+			}
+			words[i] = w
+		}
+		return strings.Join(words, "")
+	},
+}
+
+// checkNaming reports an error unless naming is one of namings or empty.
+func checkNaming(naming string) error {
+	if _, ok := namings[naming]; naming != "" && !ok {
+		return fmt.Errorf("unknown -naming %q", naming)
+	}
+	return nil
+}
+
+// namedKey returns the JSON key of the field name under naming, which is
+// name itself if empty.
+func namedKey(naming, name string) string {
+	f, ok := namings[naming]
+	if !ok {
+		return name
+	}
+	return f(splitWords(name))
+}
+
+// splitWords splits the identifier name into words at underscores and at
+// changes of case, keeping initialisms together, e.g. "HTTPServer_ID" into
+// "HTTP", "Server" and "ID".
+func splitWords(name string) []string {
+	var words []string
+	for _, part := range strings.Split(name, "_") {
+		rs := []rune(part)
+		start := 0
+		for i := 1; i < len(rs); i++ {
+			lower := unicode.IsLower(rs[i-1]) || unicode.IsDigit(rs[i-1])
+			if unicode.IsUpper(rs[i]) && (lower || i+1 < len(rs) && unicode.IsLower(rs[i+1])) {
+				words = append(words, string(rs[start:i]))
+				start = i
+			}
+		}
+		if start < len(rs) {
+			words = append(words, string(rs[start:]))
+		}
+	}
+	return words
+}
+
+// localNames are the variables and types declared by the generated
+// methods, which shadow the identifiers of the package of the same names.
+var localNames = map[string]bool{
+	"aux": true, "b": true, "buf": true, "clone": true, "convert": true,
+	"ctx": true, "d": true, "dec": true, "e": true, "enc": true, "err": true,
+	"errs": true, "head": true, "i": true, "k": true, "key": true, "keys": true,
+	"l": true, "lhs": true, "n": true, "name": true, "ok": true, "other": true,
+	"raw": true, "rhs": true, "src": true, "start": true, "text": true,
+	"value": true, "w": true, "Alias": true, "Aux": true,
+}
+
+// reservedNames are the identifiers used by the generated methods besides
+// localNames, which the receiver would shadow or conflict with too.
+var reservedNames = map[string]bool{
+	// Packages imported by the generated files.
+	"bson": true, "bytes": true, "cbor": true, "context": true, "direct": true,
+	"driver": true, "errors": true, "fmt": true, "io": true, "json": true,
+	"jsontext": true, "msgpack": true, "reflect": true, "strconv": true,
+	"sync": true, "time": true, "xml": true, "yaml": true,
+}
+
+// receiverName returns the receiver of the methods of the type name under
+// the pattern of Options.Receiver or the encjsongen:receiver directive, in
+// which "{initial}" is replaced by the lower-cased first letter of name.
+func receiverName(pattern, name string) (string, error) {
+	if pattern == "" {
+		pattern = "v"
+	}
+	r, _ := utf8.DecodeRuneInString(name)
+	recv := strings.Replace(pattern, "{initial}", string(unicode.ToLower(r)), -1)
+	switch {
+	case !token.IsIdentifier(recv) || recv == "_":
+		return "", fmt.Errorf("invalid receiver %q", recv)
+	case localNames[recv] || reservedNames[recv] || types.Universe.Lookup(recv) != nil:
+		return "", fmt.Errorf("receiver %q conflicts with an identifier of the generated methods", recv)
+	case strings.HasPrefix(recv, "alias") || strings.HasPrefix(recv, "omit"):
+		return "", fmt.Errorf("receiver %q conflicts with the variables of the aliases", recv)
+	}
+	return recv, nil
+}
+
+// shadowed reports whether name, an identifier of the package, is shadowed
+// in the generated methods by localNames or the variables of the aliases
+// of the fields, e.g. aliasCreateTime.
+func (si *structInfo) shadowed(name string) bool {
+	if localNames[name] {
+		return true
+	}
+	for _, prefix := range []string{"alias", "omit"} {
+		if field := strings.TrimPrefix(name, prefix); field != name {
+			if _, err := si.field(field); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package generator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// oneOfField is a variant of a struct type with the encjsongen:oneof
+// directive.
+type oneOfField struct {
+	Name string
+	key  string
+	typ  types.Type
+}
+
+// Key returns the JSON key of f quoted as a Go string.
+func (f oneOfField) Key() string {
+	b, _ := json.Marshal(f.key)
+	return rawLiteral(string(b))
+}
+
+// SetOneOf makes si a struct type of which exactly one pointer field is
+// set, as by the encjsongen:oneof directive. Its fields encoded by
+// encoding/json are the variants.
+func (si *structInfo) SetOneOf() error {
+	st := si.typ.Underlying().(*types.Struct)
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		key := reflect.StructTag(st.Tag(i)).Get("json")
+		if i := strings.Index(key, ","); i >= 0 {
+			key = key[:i]
+		}
+		if !f.Exported() || key == "-" {
+			continue
+		}
+		if f.Embedded() {
+			return fmt.Errorf("oneof does not support the embedded field %s", f.Name())
+		}
+		if _, ok := f.Type().Underlying().(*types.Pointer); !ok {
+			return fmt.Errorf("oneof requires pointer fields, but %s is %s", f.Name(), si.typeString(f.Type()))
+		}
+		if key == "" {
+			key = f.Name()
+		}
+		si.OneOf = append(si.OneOf, oneOfField{Name: f.Name(), key: key, typ: f.Type()})
+	}
+	if len(si.OneOf) < 2 {
+		return errors.New("oneof requires two or more pointer fields")
+	}
+	return nil
+}
+
+// OneOfError returns the error of the number n of the variants set other
+// than one.
+func (si *structInfo) OneOfError() string {
+	keys := make([]string, len(si.OneOf))
+	for i, f := range si.OneOf {
+		keys[i] = f.key
+	}
+	list := strings.Join(keys[:len(keys)-1], ", ") + " or " + keys[len(keys)-1]
+	msg := si.Receiver + ": exactly one of " + strings.Replace(list, "%", "%%", -1) + " must be set, but got %d"
+	return fmt.Sprintf("fmt.Errorf(%s, n)", strconv.Quote(msg))
+}
+
+// The object of MarshalJSON has the key of the variant set only.
+const tmplMarshalOneOf = `func ({{.Recv}} {{.MarshalReceiver}}) MarshalJSON() ([]byte, error) {
+	{{- if .BeforeMarshal }}
+	if err := {{.Recv}}.BeforeMarshalJSON(); err != nil {
+		return nil, err
+	}
+	{{- end }}
+	var (
+		n     int
+		key   string
+		value interface{}
+	)
+	{{- range .OneOf }}
+	if {{$.Recv}}.{{.Name}} != nil {
+		n, key, value = n+1, {{.Key}}, {{$.Recv}}.{{.Name}}
+	}
+	{{- end }}
+	if n != 1 {
+		return nil, {{.OneOfError}}
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("{"+key+":"), append(b, '}')...), nil
+}
+`
+
+// UnmarshalJSON decodes into a copy of the receiver with the variants
+// reset, so that those set before are not counted, and null is not counted
+// either. The receiver is set only if exactly one variant is, and is left
+// as it is by null, as json.Unmarshal does.
+const tmplUnmarshalOneOf = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	type Alias {{.Receiver}}{{.TypeParams}}
+	{{- if .Reset }}
+	var aux Alias
+	{{- else }}
+	aux := Alias(*{{.Recv}})
+	{{- end }}
+	{{- range .OneOf }}
+	aux.{{.Name}} = nil
+	{{- end }}
+	{{- if or .Strict .UseNumber }}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	{{- if .Strict }}
+	dec.DisallowUnknownFields()
+	{{- end }}
+	{{- if .UseNumber }}
+	dec.UseNumber()
+	{{- end }}
+	if err := dec.Decode(&aux); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			err = errors.New("json: invalid data after top-level value")
+		}
+		return err
+	}
+	{{- else }}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	{{- end }}
+	var n int
+	{{- range .OneOf }}
+	if aux.{{.Name}} != nil {
+		n++
+	}
+	{{- end }}
+	if n != 1 {
+		return {{.OneOfError}}
+	}
+	*{{.Recv}} = {{.Receiver}}{{.TypeParams}}(aux)
+	{{- if .AfterUnmarshal }}
+	return {{.Recv}}.AfterUnmarshalJSON()
+	{{- else }}
+	return nil
+	{{- end }}
+}
+`
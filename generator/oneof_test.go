@@ -0,0 +1,42 @@
+package generator
+
+import "testing"
+
+func TestUnmarshalOneOf(t *testing.T) {
+	const src = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+//encjsongen:oneof
+type T struct {
+	A *int    ` + "`json:\"a\"`" + `
+	B *string ` + "`json:\"b\"`" + `
+}
+
+func main() {
+	for _, in := range []string{
+		"null",
+		"{\"a\":1,\"b\":\"x\"}",
+		"{}",
+		"{\"b\":\"y\"}",
+	} {
+		a := 2
+		v := T{A: &a}
+		err := json.Unmarshal([]byte(in), &v)
+		b, _ := json.Marshal(&v)
+		fmt.Println(string(b), err != nil)
+	}
+}
+`
+	const want = `{"a":2} false
+{"a":2} true
+{"a":2} true
+{"b":"y"} false
+`
+	if got := run(t, src, Options{}); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
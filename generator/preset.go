@@ -0,0 +1,260 @@
+package generator
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"path"
+	"strings"
+)
+
+// preset is a well-known EXPR;ASSIGN pair. Since the packages used in the
+// expressions may not be imported by the source file, presets are not
+// type checked and carry the alias type instead.
+type preset struct {
+	Field     string // type of the field, qualified by package path
+	Type      string
+	Expr      string
+	ExprErr   bool
+	Assign    string
+	AssignErr bool
+
+	aliasType types.Type // of Type unless it is predeclared
+	sample    string     // of the field for the tests, unless sampleValue
+	path      string     // imported for Type and the expressions, unless of the standard library
+}
+
+var presets = map[string]preset{
+	"unix": {
+		Field:  "time.Time",
+		Type:   "int64",
+		Expr:   "$.Unix()",
+		Assign: "time.Unix($, 0)",
+	},
+	"unixmilli": {
+		Field:  "time.Time",
+		Type:   "int64",
+		Expr:   "$.UnixMilli()",
+		Assign: "time.UnixMilli($)",
+	},
+	"rfc3339": {
+		Field:     "time.Time",
+		Type:      "string",
+		Expr:      "$.Format(time.RFC3339)",
+		Assign:    "time.Parse(time.RFC3339, $)",
+		AssignErr: true,
+	},
+	"base64": {
+		Field:     "[]byte",
+		Type:      "string",
+		Expr:      "base64.StdEncoding.EncodeToString($)",
+		Assign:    "base64.StdEncoding.DecodeString($)",
+		AssignErr: true,
+	},
+	"stringnum": {
+		Field:     "int64",
+		Type:      "string",
+		Expr:      "strconv.FormatInt($, 10)",
+		Assign:    "strconv.ParseInt($, 10, 64)",
+		AssignErr: true,
+	},
+	"raw": {
+		Field:     "[]byte",
+		Type:      "json.RawMessage",
+		Expr:      "json.RawMessage($)",
+		Assign:    "[]byte($)",
+		aliasType: rawMessage,
+		// The field holds JSON.
+		sample: "[]byte(`{}`)",
+	},
+	"timestamppb": {
+		Field:     "time.Time",
+		Type:      "*timestamppb.Timestamp",
+		Expr:      "timestamppb.New($)",
+		Assign:    "$.AsTime()",
+		aliasType: protoMessage(timestamppbPath, "Timestamp"),
+		path:      timestamppbPath,
+	},
+	"durationpb": {
+		Field:     "time.Duration",
+		Type:      "*durationpb.Duration",
+		Expr:      "durationpb.New($)",
+		Assign:    "$.AsDuration()",
+		aliasType: protoMessage(durationpbPath, "Duration"),
+		path:      durationpbPath,
+	},
+	// big.Int has no function returning an error.
+	"bigint": {
+		Field:     "math/big.Int",
+		Type:      "string",
+		Expr:      "$.String()",
+		Assign:    "func() (n big.Int, err error) {\nerr = n.UnmarshalText([]byte($))\nreturn\n}()",
+		AssignErr: true,
+	},
+	"decimal": {
+		Field:     "github.com/shopspring/decimal.Decimal",
+		Type:      "string",
+		Expr:      "$.String()",
+		Assign:    "decimal.NewFromString($)",
+		AssignErr: true,
+		path:      "github.com/shopspring/decimal",
+	},
+}
+
+// The packages of the well-known types of protobuf.
+const (
+	timestamppbPath = "google.golang.org/protobuf/types/known/timestamppb"
+	durationpbPath  = "google.golang.org/protobuf/types/known/durationpb"
+)
+
+// rawMessage stands for json.RawMessage, which is encoded by its
+// MarshalJSON as is.
+var rawMessage = func() types.Type {
+	pkg := types.NewPackage("encoding/json", "json")
+	bytes := types.NewSlice(types.Typ[types.Byte])
+	named := types.NewNamed(types.NewTypeName(token.NoPos, pkg, "RawMessage", nil), bytes, nil)
+	results := types.NewTuple(
+		types.NewVar(token.NoPos, nil, "", bytes),
+		types.NewVar(token.NoPos, nil, "", types.Universe.Lookup("error").Type()),
+	)
+	recv := types.NewVar(token.NoPos, pkg, "m", named)
+	named.AddMethod(types.NewFunc(token.NoPos, pkg, "MarshalJSON", types.NewSignatureType(recv, nil, nil, nil, results, false)))
+	return named
+}()
+
+// protoMessage stands for the pointer to the message name of the package
+// of protobuf at importPath, which has the Seconds and Nanos fields as
+// encoded by encoding/json, and the unexported state of the messages
+// making it incomparable.
+func protoMessage(importPath, name string) types.Type {
+	pkg := types.NewPackage(importPath, path.Base(importPath))
+	fields := []*types.Var{
+		types.NewField(token.NoPos, pkg, "state", types.NewSignatureType(nil, nil, nil, nil, nil, false), false),
+		types.NewField(token.NoPos, pkg, "Seconds", types.Typ[types.Int64], false),
+		types.NewField(token.NoPos, pkg, "Nanos", types.Typ[types.Int32], false),
+	}
+	tags := []string{"", `json:"seconds,omitempty"`, `json:"nanos,omitempty"`}
+	named := types.NewNamed(types.NewTypeName(token.NoPos, pkg, name, nil), types.NewStruct(fields, tags), nil)
+	return types.NewPointer(named)
+}
+
+// presetGroups are the presets of the names applying to several field
+// types, of which the one of the field is used.
+var presetGroups = map[string][]preset{
+	"null": {
+		sqlNull("NullString", "String", "string", types.Typ[types.String]),
+		sqlNull("NullInt64", "Int64", "int64", types.Typ[types.Int64]),
+		sqlNull("NullTime", "Time", "time.Time", timeType),
+		guregu("String", "string", types.Typ[types.String]),
+		guregu("Int", "int64", types.Typ[types.Int64]),
+		guregu("Time", "time.Time", timeType),
+	},
+}
+
+// sqlNull returns the preset of @null for the type name of database/sql
+// holding the value of typ in field, as a pointer left nil unless Valid.
+func sqlNull(name, field, typ string, t types.Type) preset {
+	return preset{
+		Field:     "database/sql." + name,
+		Type:      "*" + typ,
+		Expr:      fmt.Sprintf("func(n sql.%[1]s) *%[3]s {\nif !n.Valid {\nreturn nil\n}\np := new(%[3]s)\n*p = n.%[2]s\nreturn p\n}($)", name, field, typ),
+		Assign:    fmt.Sprintf("func(p *%[3]s) sql.%[1]s {\nif p == nil {\nreturn sql.%[1]s{}\n}\nreturn sql.%[1]s{%[2]s: *p, Valid: true}\n}($)", name, field, typ),
+		aliasType: types.NewPointer(t),
+	}
+}
+
+// gureguPath is the package of the nullable types of guregu/null.
+const gureguPath = "gopkg.in/guregu/null.v4"
+
+// guregu returns the preset of @null for the type name of guregu/null
+// holding the value of typ.
+func guregu(name, typ string, t types.Type) preset {
+	return preset{
+		Field:     gureguPath + "." + name,
+		Type:      "*" + typ,
+		Expr:      "$.Ptr()",
+		Assign:    "null." + name + "FromPtr($)",
+		aliasType: types.NewPointer(t),
+		path:      gureguPath,
+	}
+}
+
+// timeType stands for time.Time, compared by its Equal method.
+var timeType = func() types.Type {
+	pkg := types.NewPackage("time", "time")
+	fields := []*types.Var{
+		types.NewField(token.NoPos, pkg, "wall", types.Typ[types.Uint64], false),
+		types.NewField(token.NoPos, pkg, "ext", types.Typ[types.Int64], false),
+	}
+	named := types.NewNamed(types.NewTypeName(token.NoPos, pkg, "Time", nil), types.NewStruct(fields, nil), nil)
+	params := types.NewTuple(types.NewVar(token.NoPos, pkg, "u", named))
+	results := types.NewTuple(types.NewVar(token.NoPos, nil, "", types.Typ[types.Bool]))
+	recv := types.NewVar(token.NoPos, pkg, "t", named)
+	named.AddMethod(types.NewFunc(token.NoPos, pkg, "Equal", types.NewSignatureType(recv, nil, nil, params, results, false)))
+	return named
+}()
+
+// lookupPreset returns the preset for a field of type t, and the kind of
+// element-wise conversion if the preset applies to its elements.
+func lookupPreset(name string, t types.Type) (*preset, string, error) {
+	group, ok := presetGroups[name]
+	if p, found := presets[name]; found {
+		group, ok = []preset{p}, true
+	}
+	if !ok {
+		return nil, "", fmt.Errorf("unknown preset @%s", name)
+	}
+	fields := make([]string, len(group))
+	for i := range group {
+		if kind, ok := group[i].match(t); ok {
+			return &group[i], kind, nil
+		}
+		fields[i] = group[i].Field
+	}
+	return nil, "", fmt.Errorf("@%s requires a %s field, but got %s", name, strings.Join(fields, ", "), qualifiedTypeString(t))
+}
+
+// match reports whether p applies to a field of type t, and the kind of
+// element-wise conversion if to its elements.
+func (p *preset) match(t types.Type) (string, bool) {
+	if qualifiedTypeString(t) == p.Field {
+		return "", true
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Slice:
+		if qualifiedTypeString(u.Elem()) == p.Field {
+			return kindSlice, true
+		}
+	case *types.Map:
+		if qualifiedTypeString(u.Elem()) == p.Field {
+			return kindMap, true
+		}
+	case *types.Pointer:
+		if qualifiedTypeString(u.Elem()) == p.Field {
+			return kindPtr, true
+		}
+	}
+	return "", false
+}
+
+func qualifiedTypeString(t types.Type) string {
+	return types.TypeString(t, (*types.Package).Path)
+}
+
+// alias returns the alias of the preset with "$" substituted by op.
+func (p *preset) alias(op operand) alias {
+	t := p.aliasType
+	if t == nil {
+		t = types.Universe.Lookup(p.Type).Type()
+	}
+	return alias{
+		Type:      p.Type,
+		aliasType: t,
+		Expr:      substitute(p.Expr, op.marshal),
+		ExprErr:   p.ExprErr,
+		Assign:    substitute(p.Assign, op.unmarshal),
+		AssignErr: p.AssignErr,
+		sample:    p.sample,
+		path:      p.path,
+	}
+}
@@ -0,0 +1,95 @@
+package generator
+
+import "testing"
+
+func TestPresetAbsent(t *testing.T) {
+	const src = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type T struct {
+	Time time.Time ` + "`json:\"-\" customjson:\"time=@rfc3339\"`" + `
+	Data []byte    ` + "`json:\"-\" customjson:\"data=@base64\"`" + `
+	Num  int64     ` + "`json:\"-\" customjson:\"num=@stringnum\"`" + `
+}
+
+func main() {
+	for _, in := range []string{
+		"{}",
+		"{\"time\":null,\"data\":null,\"num\":null}",
+		"{\"time\":\"2000-01-01T00:00:00Z\",\"data\":\"Yg==\",\"num\":\"2\"}",
+	} {
+		v := T{Time: time.Unix(0, 0).UTC(), Data: []byte("a"), Num: 1}
+		err := json.Unmarshal([]byte(in), &v)
+		fmt.Println(v.Time.Year(), string(v.Data), v.Num, err)
+	}
+}
+`
+	const want = `1970 a 1 <nil>
+1970 a 1 <nil>
+2000 b 2 <nil>
+`
+	if got := run(t, src, Options{}); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPresetNumberAbsent(t *testing.T) {
+	const src = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/shopspring/decimal"
+)
+
+type T struct {
+	Int big.Int         ` + "`json:\"-\" customjson:\"int=@bigint\"`" + `
+	Dec decimal.Decimal ` + "`json:\"-\" customjson:\"dec=@decimal\"`" + `
+}
+
+func main() {
+	for _, in := range []string{
+		"{}",
+		"{\"int\":null,\"dec\":null}",
+		"{\"int\":\"2\",\"dec\":\"2.5\"}",
+	} {
+		var v T
+		v.Int.SetInt64(1)
+		v.Dec, _ = decimal.NewFromString("1.5")
+		err := json.Unmarshal([]byte(in), &v)
+		fmt.Println(v.Int.String(), v.Dec, err)
+	}
+}
+`
+	// decimal stands for github.com/shopspring/decimal, failing on "" as
+	// it does.
+	decimal := stubModule{"github.com/shopspring/decimal", `package decimal
+
+import "errors"
+
+type Decimal struct{ s string }
+
+func NewFromString(s string) (Decimal, error) {
+	if s == "" {
+		return Decimal{}, errors.New("can't convert  to decimal")
+	}
+	return Decimal{s}, nil
+}
+
+func (d Decimal) String() string { return d.s }
+`}
+	const want = `1 1.5 <nil>
+1 1.5 <nil>
+2 2.5 <nil>
+`
+	if got := run(t, src, Options{}, decimal); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
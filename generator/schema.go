@@ -0,0 +1,296 @@
+package generator
+
+import (
+	"encoding/json"
+	"go/types"
+	"reflect"
+	"strings"
+)
+
+// schema is a JSON Schema of the JSON encoding of a Go type.
+type schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Defs                 map[string]*schema `json:"$defs,omitempty"`
+
+	keys []string // of Properties in the order of the fields
+}
+
+// schemaBuilder builds the schemas of types of a package. Named structs
+// and converted types are collected into defs and referenced by ref.
+type schemaBuilder struct {
+	pkg   *types.Package
+	infos map[*types.TypeName]*structInfo // encoded by the generated methods
+	defs  map[string]*schema
+	ref   func(name string) string
+}
+
+func newSchemaBuilder(pkg *types.Package, infos []*structInfo, ref func(name string) string) *schemaBuilder {
+	b := &schemaBuilder{
+		pkg:   pkg,
+		infos: make(map[*types.TypeName]*structInfo),
+		defs:  make(map[string]*schema),
+		ref:   ref,
+	}
+	for _, si := range infos {
+		if n, ok := si.typ.(*types.Named); ok {
+			b.infos[n.Obj()] = si
+		}
+	}
+	return b
+}
+
+// define adds the schema of si to defs unless already added, and returns
+// its name.
+func (b *schemaBuilder) define(si *structInfo) string {
+	name := si.Receiver
+	if _, ok := b.defs[name]; ok {
+		return name
+	}
+	s := new(schema)
+	// Added before building for recursive types.
+	b.defs[name] = s
+	if si.Value != nil {
+		*s = *b.typeSchema(si.Value.aliasType)
+		return name
+	}
+	if si.Enum != nil {
+		s.Type = "string"
+		for _, e := range si.Enum {
+			s.Enum = append(s.Enum, e.Name)
+		}
+		return name
+	}
+	*s = *b.structSchema(si.typ.Underlying().(*types.Struct), si.Aliases)
+	return name
+}
+
+// typeSchema returns the schema of t as encoded by encoding/json.
+func (b *schemaBuilder) typeSchema(t types.Type) *schema {
+	if n, ok := types.Unalias(t).(*types.Named); ok {
+		obj := n.Origin().Obj()
+		if obj.Pkg() != nil && obj.Pkg().Path() == "time" && obj.Name() == "Time" {
+			return &schema{Type: "string", Format: "date-time"}
+		}
+		if si, ok := b.infos[obj]; ok {
+			return &schema{Ref: b.ref(b.define(si))}
+		}
+		mset := types.NewMethodSet(types.NewPointer(n))
+		if mset.Lookup(nil, "MarshalJSON") != nil {
+			// Unknown encoding.
+			return &schema{}
+		}
+		if mset.Lookup(nil, "MarshalText") != nil {
+			return &schema{Type: "string"}
+		}
+		if st, ok := n.Underlying().(*types.Struct); ok {
+			name := types.TypeString(n, types.RelativeTo(b.pkg))
+			if _, ok := b.defs[name]; !ok {
+				s := new(schema)
+				b.defs[name] = s
+				*s = *b.structSchema(st, nil)
+			}
+			return &schema{Ref: b.ref(name)}
+		}
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch info := u.Info(); {
+		case info&types.IsBoolean != 0:
+			return &schema{Type: "boolean"}
+		case info&types.IsInteger != 0:
+			return &schema{Type: "integer"}
+		case info&types.IsFloat != 0:
+			return &schema{Type: "number"}
+		case info&types.IsString != 0:
+			return &schema{Type: "string"}
+		}
+	case *types.Slice:
+		if e, ok := u.Elem().Underlying().(*types.Basic); ok && e.Kind() == types.Byte {
+			return &schema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &schema{Type: "array", Items: b.typeSchema(u.Elem())}
+	case *types.Array:
+		return &schema{Type: "array", Items: b.typeSchema(u.Elem())}
+	case *types.Map:
+		return &schema{Type: "object", AdditionalProperties: b.typeSchema(u.Elem())}
+	case *types.Pointer:
+		return b.typeSchema(u.Elem())
+	case *types.Struct:
+		return b.structSchema(u, nil)
+	}
+	return &schema{}
+}
+
+// jsonField is a field of a struct as encoded by encoding/json.
+type jsonField struct {
+	key       string
+	typ       types.Type
+	omitempty bool
+	str       bool // with the string option
+	depth     int  // of embedding
+	tagged    bool // with the name in the tag
+	alias     *alias
+
+	path []*types.Var // from the struct, through the embedded fields
+}
+
+// structSchema returns the schema of st whose fields are converted by
+// aliases, which take precedence over the fields at any depth as they do
+// in the generated methods.
+func (b *schemaBuilder) structSchema(st *types.Struct, aliases []alias) *schema {
+	var fields []jsonField
+	for i := range aliases {
+		a := &aliases[i]
+		if a.Inline() {
+			fields = append(fields, a.inlineFields()...)
+			continue
+		}
+		fields = append(fields, jsonField{
+			key:       a.Key(),
+			typ:       a.aliasType,
+			omitempty: strings.Contains(a.JSONKey, ",omitempty"),
+			str:       strings.Contains(a.JSONKey, ",string"),
+			depth:     -1,
+			alias:     a,
+		})
+	}
+	fields = collectFields(fields, st, nil)
+
+	s := &schema{Type: "object", Properties: make(map[string]*schema)}
+	depths := make(map[string]int)
+	for _, f := range fields {
+		if d, ok := depths[f.key]; ok && d <= f.depth {
+			continue
+		}
+		depths[f.key] = f.depth
+		fs := b.typeSchema(f.typ)
+		if f.str {
+			fs = &schema{Type: "string"}
+		}
+		if _, ok := s.Properties[f.key]; !ok {
+			s.keys = append(s.keys, f.key)
+		}
+		s.Properties[f.key] = fs
+	}
+	for _, key := range s.keys {
+		for _, f := range fields {
+			if f.key != key || f.depth != depths[key] {
+				continue
+			}
+			if f.alias != nil && f.alias.Required || !f.omitempty && (f.alias == nil || f.alias.Expr != "" && f.alias.OmitIf == "") {
+				s.Required = append(s.Required, key)
+			}
+			break
+		}
+	}
+	return s
+}
+
+// maxEmbedDepth limits embedded structs followed by collectFields, which
+// may be recursive through pointers.
+const maxEmbedDepth = 10
+
+// collectFields appends the fields of st encoded by encoding/json to
+// fields, flattening embedded structs. st is embedded through path.
+func collectFields(fields []jsonField, st *types.Struct, path []*types.Var) []jsonField {
+	depth := len(path)
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		tag := reflect.StructTag(st.Tag(i)).Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if j := strings.Index(tag, ","); j >= 0 {
+			name, opts = tag[:j], tag[j:]
+		}
+		if f.Embedded() && name == "" {
+			t := f.Type()
+			if p, ok := t.Underlying().(*types.Pointer); ok {
+				t = p.Elem()
+			}
+			if est, ok := t.Underlying().(*types.Struct); ok {
+				if depth < maxEmbedDepth {
+					fields = collectFields(fields, est, append(path[:depth:depth], f))
+				}
+				continue
+			}
+			if !f.Exported() {
+				continue
+			}
+		} else if !f.Exported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name()
+		}
+		fields = append(fields, jsonField{
+			key:       name,
+			typ:       f.Type(),
+			omitempty: strings.Contains(opts, ",omitempty"),
+			str:       strings.Contains(opts, ",string"),
+			depth:     depth,
+			tagged:    tag != "" && tag[0] != ',',
+			path:      append(path[:depth:depth], f),
+		})
+	}
+	return fields
+}
+
+// schemaFile returns the JSON Schema of si, written to the file of
+// Options.SchemaOut. Types of infos are referenced as converted by the
+// generated methods.
+func schemaFile(si *structInfo, infos []*structInfo) ([]byte, error) {
+	b := newSchemaBuilder(si.pkg, infos, func(name string) string {
+		if name == si.Receiver {
+			return "#"
+		}
+		return "#/$defs/" + name
+	})
+	b.define(si)
+	doc := b.defs[si.Receiver]
+	delete(b.defs, si.Receiver)
+	doc.Schema = "https://json-schema.org/draft/2020-12/schema"
+	doc.Title = si.Receiver
+	if len(b.defs) > 0 {
+		doc.Defs = b.defs
+	}
+	src, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(src, '\n'), nil
+}
+
+// openAPIFile returns the schemas of infos as OpenAPI components, written
+// to the file of Options.OpenAPIOut for other documents to reference by
+// "<file>#/components/schemas/<name>".
+func openAPIFile(infos []*structInfo) ([]byte, error) {
+	b := newSchemaBuilder(infos[0].pkg, infos, func(name string) string {
+		return "#/components/schemas/" + name
+	})
+	for _, si := range infos {
+		b.define(si)
+	}
+	doc := map[string]interface{}{
+		"components": map[string]interface{}{
+			"schemas": b.defs,
+		},
+	}
+	src, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(src, '\n'), nil
+}
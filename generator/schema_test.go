@@ -0,0 +1,198 @@
+package generator
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// schemaSrc has a converted type referring to another, and a type of the
+// package which is not converted.
+const schemaSrc = `package main
+
+import "time"
+
+type User struct {
+	Name       string    ` + "`json:\"name\"`" + `
+	Age        int       ` + "`json:\"age,omitempty\"`" + `
+	CreateTime time.Time ` + "`json:\"-\" customjson:\"createTime=$.Unix();time.Unix($, 0)\"`" + `
+	Tags       []string  ` + "`json:\"tags\"`" + `
+	Group      *Group    ` + "`json:\"group,omitempty\"`" + `
+	Meta       Meta      ` + "`json:\"meta\"`" + `
+}
+
+type Group struct {
+	ID    int64  ` + "`json:\"-\" customjson:\"id=$;$\"`" + `
+	Users []User ` + "`json:\"users\"`" + `
+}
+
+type Meta struct {
+	Data []byte ` + "`json:\"data\"`" + `
+}
+`
+
+// generatedFile returns the content of the file of the base name in files
+// generated for src with opts.
+func generatedFile(t *testing.T, src string, opts Options, name string) string {
+	t.Helper()
+	files, diags := generate(t, filepath.Join(t.TempDir(), "main.go"), src, opts)
+	for _, d := range diags {
+		t.Error(d)
+	}
+	for _, f := range files {
+		if filepath.Base(f.Name) == name {
+			return string(f.Content)
+		}
+	}
+	t.Fatalf("%s is not generated", name)
+	return ""
+}
+
+func TestSchemaFile(t *testing.T) {
+	got := generatedFile(t, schemaSrc, Options{SchemaOut: "{name}.schema.json"}, "user.schema.json")
+	const want = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "User",
+  "type": "object",
+  "properties": {
+    "age": {
+      "type": "integer"
+    },
+    "createTime": {
+      "type": "integer"
+    },
+    "group": {
+      "$ref": "#/$defs/Group"
+    },
+    "meta": {
+      "$ref": "#/$defs/Meta"
+    },
+    "name": {
+      "type": "string"
+    },
+    "tags": {
+      "type": "array",
+      "items": {
+        "type": "string"
+      }
+    }
+  },
+  "required": [
+    "createTime",
+    "name",
+    "tags",
+    "meta"
+  ],
+  "$defs": {
+    "Group": {
+      "type": "object",
+      "properties": {
+        "id": {
+          "type": "integer"
+        },
+        "users": {
+          "type": "array",
+          "items": {
+            "$ref": "#"
+          }
+        }
+      },
+      "required": [
+        "id",
+        "users"
+      ]
+    },
+    "Meta": {
+      "type": "object",
+      "properties": {
+        "data": {
+          "type": "string",
+          "contentEncoding": "base64"
+        }
+      },
+      "required": [
+        "data"
+      ]
+    }
+  }
+}
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestOpenAPIFile(t *testing.T) {
+	got := generatedFile(t, schemaSrc, Options{OpenAPIOut: "openapi.json"}, "openapi.json")
+	const want = `{
+  "components": {
+    "schemas": {
+      "Group": {
+        "type": "object",
+        "properties": {
+          "id": {
+            "type": "integer"
+          },
+          "users": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/User"
+            }
+          }
+        },
+        "required": [
+          "id",
+          "users"
+        ]
+      },
+      "Meta": {
+        "type": "object",
+        "properties": {
+          "data": {
+            "type": "string",
+            "contentEncoding": "base64"
+          }
+        },
+        "required": [
+          "data"
+        ]
+      },
+      "User": {
+        "type": "object",
+        "properties": {
+          "age": {
+            "type": "integer"
+          },
+          "createTime": {
+            "type": "integer"
+          },
+          "group": {
+            "$ref": "#/components/schemas/Group"
+          },
+          "meta": {
+            "$ref": "#/components/schemas/Meta"
+          },
+          "name": {
+            "type": "string"
+          },
+          "tags": {
+            "type": "array",
+            "items": {
+              "type": "string"
+            }
+          }
+        },
+        "required": [
+          "createTime",
+          "name",
+          "tags",
+          "meta"
+        ]
+      }
+    }
+  }
+}
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,114 @@
+package generator
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+// operandOffsets returns the offsets of the "$" operands in src, which are
+// the ones out of the string and rune literals and the comments.
+func operandOffsets(src string) []int {
+	var (
+		s       scanner.Scanner
+		offsets []int
+	)
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", -1, len(src)), []byte(src), nil, 0)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return offsets
+		}
+		if tok == token.ILLEGAL && lit == "$" {
+			offsets = append(offsets, fset.Position(pos).Offset)
+		}
+	}
+}
+
+// bindOperand returns src with its "$" operands replaced by name, such as
+// placeholder for src to be parsed.
+func bindOperand(src, name string) string {
+	var (
+		b    strings.Builder
+		last int
+	)
+	for _, off := range operandOffsets(src) {
+		b.WriteString(src[last:off])
+		b.WriteString(name)
+		last = off + 1
+	}
+	b.WriteString(src[last:])
+	return b.String()
+}
+
+// fieldRef is a reference "$Name" to the field Name of the struct, which
+// is the "$" operand at Offset immediately followed by the identifier.
+type fieldRef struct {
+	Offset int
+	Name   string
+}
+
+// fieldRefs returns the field references of src, whose "$" are operands
+// too, so that bindOperand binds them to placeholder followed by the name.
+func fieldRefs(src string) []fieldRef {
+	var (
+		s    scanner.Scanner
+		refs []fieldRef
+		prev = -1 // offset of the "$" just before, if any
+	)
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", -1, len(src)), []byte(src), nil, 0)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return refs
+		}
+		off := fset.Position(pos).Offset
+		if tok == token.IDENT && prev >= 0 && off == prev+1 {
+			refs = append(refs, fieldRef{Offset: prev, Name: lit})
+		}
+		prev = -1
+		if tok == token.ILLEGAL && lit == "$" {
+			prev = off
+		}
+	}
+}
+
+// substitute returns the unescaped src with its "$" operands replaced by
+// repl, and the escaped ones by "$" as they are. The operands are the
+// identifiers of placeholder in the syntax tree of src, which is printed
+// back with them renamed, so that the "$" of the literals are kept.
+func substitute(src, repl string) string {
+	return substituteFields(src, repl, "")
+}
+
+// substituteFields is substitute replacing the field references "$Name"
+// by the field Name of recv as well.
+func substituteFields(src, repl, recv string) string {
+	fset := token.NewFileSet()
+	e, err := parser.ParseExprFrom(fset, "", bindOperand(src, placeholder), 0)
+	if err != nil {
+		return literal(bindOperand(src, repl))
+	}
+	ast.Inspect(e, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		switch {
+		case !ok:
+		case id.Name == placeholder:
+			id.Name = repl
+		case strings.HasPrefix(id.Name, placeholder):
+			id.Name = recv + "." + id.Name[len(placeholder):]
+		}
+		return true
+	})
+	var b bytes.Buffer
+	if err := printer.Fprint(&b, fset, e); err != nil {
+		return literal(bindOperand(src, repl))
+	}
+	return literal(b.String())
+}
@@ -0,0 +1,72 @@
+package generator
+
+import "testing"
+
+func TestSubstitute(t *testing.T) {
+	for _, tt := range []struct {
+		src  string
+		want string
+	}{
+		{src: `$.Unix()`, want: `v.T.Unix()`},
+		{src: `$+1`, want: `v.T + 1`},
+		{src: `fmt.Sprintf("US$%d", $)`, want: `fmt.Sprintf("US$%d", v.T)`},
+		{src: "strings.TrimPrefix($, `$`)", want: "strings.TrimPrefix(v.T, `$`)"},
+		{src: `strings.IndexRune($, '$')`, want: `strings.IndexRune(v.T, '$')`},
+		{src: `$ /* $ */ * 2`, want: `v.T * 2`},
+		{src: unescape(`f($, \$)`), want: `f(v.T, $)`},
+		// The invalid expressions are substituted as they are.
+		{src: `$ +`, want: `v.T +`},
+	} {
+		if got := substitute(tt.src, "v.T"); got != tt.want {
+			t.Errorf("substitute(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestSubstituteFields(t *testing.T) {
+	const src = `$First + " $Last " + $Last`
+	const want = `v.First + " $Last " + v.Last`
+	if got := substituteFields(src, "v.First", "v"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLiteralDollar(t *testing.T) {
+	const src = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	_ = strconv.Atoi
+	_ = strings.TrimPrefix
+)
+
+type Price struct {
+	Amount int ` + "`json:\"-\" customjson:\"amount=fmt.Sprintf(\\\"US$%d\\\", $);strconv.Atoi(strings.TrimPrefix($, \\\"US$\\\"))\"`" + `
+	Symbol rune ` + "`json:\"-\" customjson:\"symbol=string($);[]rune($ + \\\"$\\\")[0];validate=$ == '$'\"`" + `
+}
+
+func main() {
+	b, err := json.Marshal(&Price{Amount: 100, Symbol: '$'})
+	fmt.Println(string(b), err)
+	var v Price
+	err = json.Unmarshal([]byte("{\"amount\":\"US$200\",\"symbol\":\"$\"}"), &v)
+	fmt.Println(v.Amount, string(v.Symbol), err)
+	fmt.Println(json.Unmarshal([]byte("{\"symbol\":\"\"}"), &v) == nil)
+}
+`
+	const want = `{"amount":"US$100","symbol":"$"} <nil>
+200 $ <nil>
+true
+`
+	for _, mode := range []string{"reflect", "direct"} {
+		if got := run(t, src, Options{Mode: mode}); got != want {
+			t.Errorf("-mode=%s: got\n%s\nwant\n%s", mode, got, want)
+		}
+	}
+}
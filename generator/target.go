@@ -0,0 +1,1045 @@
+package generator
+
+import (
+	"sort"
+	"strconv"
+)
+
+// target is a set of methods generated from the same aliases.
+type target struct {
+	imports func(o *Options) []string // import specs added to the generated file
+
+	// Templates executed with *structInfo.
+	marshal, unmarshal           string // for struct types
+	marshalNamed, unmarshalNamed string // for named non-struct types
+	marshalOneOf, unmarshalOneOf string // for struct types with the encjsongen:oneof directive
+	marshalEnum, unmarshalEnum   string // for integer types with the encjsongen:enum directive
+
+	// accepts reports whether the templates apply to si, if not nil.
+	// Other types are skipped for the target.
+	accepts func(si *structInfo) bool
+}
+
+// templates returns the templates of t applying to si.
+func (t *target) templates(si *structInfo) (marshal, unmarshal string) {
+	switch {
+	case si.Enum != nil:
+		return t.marshalEnum, t.unmarshalEnum
+	case si.Value != nil:
+		return t.marshalNamed, t.unmarshalNamed
+	case si.OneOf != nil:
+		return t.marshalOneOf, t.unmarshalOneOf
+	}
+	return t.marshal, t.unmarshal
+}
+
+var targets = map[string]*target{
+	"json": {
+		imports:        jsonImports,
+		marshal:        tmplMarshalJSON,
+		unmarshal:      tmplUnmarshalJSON,
+		marshalNamed:   tmplMarshalNamed,
+		unmarshalNamed: tmplUnmarshalNamed,
+		marshalOneOf:   tmplMarshalOneOf,
+		unmarshalOneOf: tmplUnmarshalOneOf,
+		marshalEnum:    tmplEnum,
+		unmarshalEnum:  tmplUnmarshalEnum,
+	},
+	"jsonctx": {
+		imports: func(o *Options) []string {
+			return append(jsonImports(o), `"context"`)
+		},
+		marshal: tmplMarshalJSONContext,
+		accepts: isStruct,
+	},
+	"jsonstream": {
+		imports: func(o *Options) []string {
+			return append(jsonImports(o), `"io"`)
+		},
+		marshal:      tmplEncodeJSON,
+		marshalNamed: tmplEncodeJSONNamed,
+	},
+	"jsonappend": {
+		imports: func(o *Options) []string {
+			return append(jsonImports(o), `"bytes"`)
+		},
+		marshal:      tmplAppendJSON,
+		marshalNamed: tmplAppendJSONNamed,
+	},
+	"jsonv2": {
+		imports: func(o *Options) []string {
+			return []string{`jsonv2 "encoding/json/v2"`, `"encoding/json/jsontext"`}
+		},
+		marshal:        tmplMarshalJSONTo,
+		unmarshal:      tmplUnmarshalJSONFrom,
+		marshalNamed:   tmplMarshalJSONToNamed,
+		unmarshalNamed: tmplUnmarshalJSONFromNamed,
+	},
+	"text": {
+		imports:        func(o *Options) []string { return nil },
+		marshal:        tmplMarshalText,
+		unmarshal:      tmplUnmarshalText,
+		marshalNamed:   tmplMarshalTextNamed,
+		unmarshalNamed: tmplUnmarshalTextNamed,
+		accepts:        acceptsText,
+	},
+	"bson": {
+		imports: func(o *Options) []string {
+			return []string{"bson " + strconv.Quote(o.BSONPkg)}
+		},
+		marshal:   tmplMarshalBSON,
+		unmarshal: tmplUnmarshalBSON,
+		accepts:   isStruct,
+	},
+	"yaml": {
+		imports: func(o *Options) []string {
+			return []string{`"gopkg.in/yaml.v3"`}
+		},
+		marshal:        tmplMarshalYAML,
+		unmarshal:      tmplUnmarshalYAML,
+		marshalNamed:   tmplMarshalYAMLNamed,
+		unmarshalNamed: tmplUnmarshalYAMLNamed,
+	},
+	"xml": {
+		imports:        func(o *Options) []string { return []string{`"encoding/xml"`} },
+		marshal:        tmplMarshalXML,
+		unmarshal:      tmplUnmarshalXML,
+		marshalNamed:   tmplMarshalXMLNamed,
+		unmarshalNamed: tmplUnmarshalXMLNamed,
+	},
+	"msgpack": {
+		imports: func(o *Options) []string {
+			return []string{"msgpack " + strconv.Quote(o.MsgpackPkg)}
+		},
+		marshal:        tmplEncodeMsgpack,
+		unmarshal:      tmplDecodeMsgpack,
+		marshalNamed:   tmplEncodeMsgpackNamed,
+		unmarshalNamed: tmplDecodeMsgpackNamed,
+	},
+	"cbor": {
+		imports: func(o *Options) []string {
+			return []string{`"github.com/fxamacker/cbor/v2"`}
+		},
+		marshal:        tmplMarshalCBOR,
+		unmarshal:      tmplUnmarshalCBOR,
+		marshalNamed:   tmplMarshalCBORNamed,
+		unmarshalNamed: tmplUnmarshalCBORNamed,
+	},
+	"sql": {
+		imports:        func(o *Options) []string { return []string{`"database/sql/driver"`, `"fmt"`} },
+		marshal:        tmplValue,
+		unmarshal:      tmplScan,
+		marshalNamed:   tmplValueNamed,
+		unmarshalNamed: tmplScanNamed,
+		accepts:        acceptsSQL,
+	},
+	"clone": {
+		imports:      func(o *Options) []string { return nil },
+		marshal:      tmplClone,
+		marshalNamed: tmplClone,
+		marshalOneOf: tmplClone,
+	},
+	"equal": {
+		imports:      func(o *Options) []string { return nil },
+		marshal:      tmplEqual,
+		marshalNamed: tmplEqualNamed,
+		marshalOneOf: tmplEqual,
+	},
+	"string": {
+		imports:      jsonImports,
+		marshal:      tmplString,
+		marshalNamed: tmplString,
+		marshalOneOf: tmplString,
+	},
+	"iszero": {
+		imports:      func(o *Options) []string { return nil },
+		marshal:      tmplIsZero,
+		marshalNamed: tmplIsZeroNamed,
+		marshalOneOf: tmplIsZero,
+	},
+}
+
+// jsonImports returns the import of Options.JSONPkg unless it is the
+// default.
+func jsonImports(o *Options) []string {
+	if o.JSONPkg == "encoding/json" {
+		return nil
+	}
+	return []string{"json " + strconv.Quote(o.JSONPkg)}
+}
+
+// isStruct reports whether si is a struct type, for targets encoding
+// documents.
+func isStruct(si *structInfo) bool {
+	return si.Value == nil && si.Enum == nil
+}
+
+// acceptsText reports whether si is converted from or to text by a
+// single alias.
+func acceptsText(si *structInfo) bool {
+	a := si.Value
+	if a == nil {
+		if len(si.Aliases) != 1 {
+			return false
+		}
+		a = &si.Aliases[0]
+	}
+	return a.Kind == "" && a.OmitIf == "" && (a.Type == "string" || a.Type == "[]byte")
+}
+
+// driverTypes are the types of driver.Value a column is converted to.
+var driverTypes = map[string]bool{
+	"int64":     true,
+	"float64":   true,
+	"bool":      true,
+	"[]byte":    true,
+	"string":    true,
+	"time.Time": true,
+}
+
+// acceptsSQL reports whether si is converted from or to a column by a
+// single alias.
+func acceptsSQL(si *structInfo) bool {
+	a := si.Value
+	if a == nil {
+		if len(si.Aliases) != 1 {
+			return false
+		}
+		a = &si.Aliases[0]
+	}
+	return a.Kind == "" && a.OmitIf == "" && !a.virtual && driverTypes[a.Type]
+}
+
+// ValueExpr returns EXPR of a named type for Value, whose receiver is not
+// a pointer whatever Options.ValueReceiver says.
+func (si *structInfo) ValueExpr() string {
+	return substituteFields(si.Value.exprSrc, "("+si.Recv+")", si.Recv)
+}
+
+// Targets returns the names of the targets in Options.Targets.
+func Targets() []string {
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+const tmplMarshalJSONContext = `func ({{.Recv}} {{.MarshalReceiver}}) MarshalJSONContext(ctx context.Context) ([]byte, error) {
+	{{- if .BeforeMarshal }}
+	if err := {{.Recv}}.BeforeMarshalJSON(); err != nil {
+		return nil, err
+	}
+	{{- end }}
+	{{- range .ContextPrepares "return nil, err" }}
+	{{.}}
+	{{- end }}
+	type Alias {{.Receiver}}{{.TypeParams}}
+	{{- range .InlineTypes true }}
+	{{.}}
+	{{- end }}
+	return json.Marshal(&struct {
+		*Alias
+		{{- range .Aliases }}{{ if .Expr }}
+		{{.MarshalDecl}}
+		{{- end }}{{ end }}
+	}{
+		Alias: (*Alias)({{.MarshalPtr}}),
+		{{- range .Exprs }}
+		{{.}}
+		{{- end }}
+	})
+}
+`
+
+const tmplEncodeJSON = `func ({{.Recv}} {{.MarshalReceiver}}) EncodeJSON(w io.Writer) error {
+	{{- if .BeforeMarshal }}
+	if err := {{.Recv}}.BeforeMarshalJSON(); err != nil {
+		return err
+	}
+	{{- end }}
+	{{- range .Prepares "return err" }}
+	{{.}}
+	{{- end }}
+	type Alias {{.Receiver}}{{.TypeParams}}
+	{{- range .InlineTypes true }}
+	{{.}}
+	{{- end }}
+	return json.NewEncoder(w).Encode(&struct {
+		*Alias
+		{{- range .Aliases }}{{ if .Expr }}
+		{{.MarshalDecl}}
+		{{- end }}{{ end }}
+	}{
+		Alias: (*Alias)({{.MarshalPtr}}),
+		{{- range .Exprs }}
+		{{.}}
+		{{- end }}
+	})
+}
+`
+
+const tmplEncodeJSONNamed = `func ({{.Recv}} {{.MarshalReceiver}}) EncodeJSON(w io.Writer) error {
+	{{- if .BeforeMarshal }}
+	if err := {{.Recv}}.BeforeMarshalJSON(); err != nil {
+		return err
+	}
+	{{- end }}
+	{{- with .Value }}{{ if .ExprErr }}
+	aux, err := {{.Expr}}
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(aux)
+	{{- else }}
+	return json.NewEncoder(w).Encode({{.Expr}})
+	{{- end }}{{ end }}
+}
+`
+
+// The buffer of AppendJSON grows from b, and the newline written by
+// json.Encoder is trimmed.
+const tmplAppendJSON = `func ({{.Recv}} {{.MarshalReceiver}}) AppendJSON(b []byte) ([]byte, error) {
+	{{- if .BeforeMarshal }}
+	if err := {{.Recv}}.BeforeMarshalJSON(); err != nil {
+		return b, err
+	}
+	{{- end }}
+	{{- range .Prepares "return b, err" }}
+	{{.}}
+	{{- end }}
+	type Alias {{.Receiver}}{{.TypeParams}}
+	{{- range .InlineTypes true }}
+	{{.}}
+	{{- end }}
+	buf := bytes.NewBuffer(b)
+	if err := json.NewEncoder(buf).Encode(&struct {
+		*Alias
+		{{- range .Aliases }}{{ if .Expr }}
+		{{.MarshalDecl}}
+		{{- end }}{{ end }}
+	}{
+		Alias: (*Alias)({{.MarshalPtr}}),
+		{{- range .Exprs }}
+		{{.}}
+		{{- end }}
+	}); err != nil {
+		return b, err
+	}
+	buf.Truncate(buf.Len() - 1)
+	return buf.Bytes(), nil
+}
+`
+
+const tmplAppendJSONNamed = `func ({{.Recv}} {{.MarshalReceiver}}) AppendJSON(b []byte) ([]byte, error) {
+	{{- if .BeforeMarshal }}
+	if err := {{.Recv}}.BeforeMarshalJSON(); err != nil {
+		return b, err
+	}
+	{{- end }}
+	{{- with .Value }}{{ if .ExprErr }}
+	aux, err := {{.Expr}}
+	if err != nil {
+		return b, err
+	}
+	{{- else }}
+	aux := {{.Expr}}
+	{{- end }}{{ end }}
+	buf := bytes.NewBuffer(b)
+	if err := json.NewEncoder(buf).Encode(aux); err != nil {
+		return b, err
+	}
+	buf.Truncate(buf.Len() - 1)
+	return buf.Bytes(), nil
+}
+`
+
+const tmplMarshalJSONTo = `func ({{.Recv}} {{.MarshalReceiver}}) MarshalJSONTo(enc *jsontext.Encoder) error {
+	{{- range .Prepares "return err" }}
+	{{.}}
+	{{- end }}
+	type Alias {{.Receiver}}{{.TypeParams}}
+	{{- range .InlineTypes true }}
+	{{.}}
+	{{- end }}
+	return jsonv2.MarshalEncode(enc, &struct {
+		*Alias
+		{{- range .Aliases }}{{ if .Expr }}
+		{{.MarshalDecl}}
+		{{- end }}{{ end }}
+	}{
+		Alias: (*Alias)({{.MarshalPtr}}),
+		{{- range .Exprs }}
+		{{.}}
+		{{- end }}
+	})
+}
+`
+
+const tmplUnmarshalJSONFrom = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) UnmarshalJSONFrom(dec *jsontext.Decoder) error {
+	{{- if .Reset }}
+	*{{.Recv}} = {{.Receiver}}{{.TypeParams}}{}
+	{{- end }}
+	type Alias {{.Receiver}}{{.TypeParams}}
+	{{- range .InlineTypes false }}
+	{{.}}
+	{{- end }}
+	aux := &struct {
+		*Alias
+		{{- range .Aliases }}{{ if .Assign }}
+		{{.UnmarshalDecl}}
+		{{- end }}{{ end }}
+	}{
+		Alias: (*Alias)({{.Recv}}),
+	}
+	if err := jsonv2.UnmarshalDecode(dec, aux); err != nil {
+		return err
+	}
+	{{- if .AssignErr }}
+	var err error
+	{{- end }}
+	{{- range .PlainAssigns }}
+	{{.}}
+	{{- end }}
+	return nil
+}
+`
+
+const tmplMarshalJSONToNamed = `func ({{.Recv}} {{.MarshalReceiver}}) MarshalJSONTo(enc *jsontext.Encoder) error {
+	{{- with .Value }}{{ if .ExprErr }}
+	aux, err := {{.Expr}}
+	if err != nil {
+		return err
+	}
+	return jsonv2.MarshalEncode(enc, aux)
+	{{- else }}
+	return jsonv2.MarshalEncode(enc, {{.Expr}})
+	{{- end }}{{ end }}
+}
+`
+
+const tmplUnmarshalJSONFromNamed = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) UnmarshalJSONFrom(dec *jsontext.Decoder) error {
+	{{- with .Value }}
+	var aux {{.Type}}
+	if err := jsonv2.UnmarshalDecode(dec, &aux); err != nil {
+		return err
+	}
+	{{- if .AssignErr }}
+	var err error
+	if *{{$.Recv}}, err = {{.Assign}}; err != nil {
+		return err
+	}
+	{{- else }}
+	*{{$.Recv}} = {{.Assign}}
+	{{- end }}{{ end }}
+	return nil
+}
+`
+
+const tmplMarshalText = `func ({{.Recv}} {{.MarshalReceiver}}) MarshalText() ([]byte, error) {
+	{{- range .Prepares "return nil, err" }}
+	{{.}}
+	{{- end }}
+	{{- with index .Aliases 0 }}
+	aux := struct {
+		{{.Field}} {{.Type}}
+	}{
+	{{- end }}
+		{{- range .Exprs }}
+		{{.}}
+		{{- end }}
+	}
+	return []byte(aux.{{ (index .Aliases 0).Field }}), nil
+}
+`
+
+const tmplUnmarshalText = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) UnmarshalText(text []byte) error {
+	{{- with index .Aliases 0 }}
+	aux := struct {
+		{{.Field}} {{.Type}}
+	}{
+		{{.Field}}: {{.Type}}(text),
+	}
+	{{- end }}
+	{{- if .AssignErr }}
+	var err error
+	{{- end }}
+	{{- range .PlainAssigns }}
+	{{.}}
+	{{- end }}
+	return nil
+}
+`
+
+const tmplMarshalTextNamed = `func ({{.Recv}} {{.MarshalReceiver}}) MarshalText() ([]byte, error) {
+	{{- with .Value }}{{ if .ExprErr }}
+	aux, err := {{.Expr}}
+	if err != nil {
+		return nil, err
+	}
+	{{- else }}
+	aux := {{.Expr}}
+	{{- end }}{{ end }}
+	return []byte(aux), nil
+}
+`
+
+const tmplUnmarshalTextNamed = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) UnmarshalText(text []byte) error {
+	{{- with .Value }}
+	aux := {{.Type}}(text)
+	{{- if .AssignErr }}
+	var err error
+	if *{{$.Recv}}, err = {{.Assign}}; err != nil {
+		return err
+	}
+	{{- else }}
+	*{{$.Recv}} = {{.Assign}}
+	{{- end }}{{ end }}
+	return nil
+}
+`
+
+// The alias is embedded by value since bson does not inline pointers to
+// structs.
+const tmplMarshalBSON = `func ({{.Recv}} {{.MarshalReceiver}}) MarshalBSON() ([]byte, error) {
+	{{- range .Prepares "return nil, err" }}
+	{{.}}
+	{{- end }}
+	type Alias {{.Receiver}}{{.TypeParams}}
+	return bson.Marshal(struct {
+		Alias ` + "`bson:" + `",inline"` + "`" + `
+		{{- range .Aliases }}{{ if .Expr }}
+		{{.Field}} {{.MarshalType}} ` + "`bson:" + `"{{.MarshalTargetKey}}"` + "`" + `
+		{{- end }}{{ end }}
+	}{
+		Alias: Alias({{.MarshalValue}}),
+		{{- range .Exprs }}
+		{{.}}
+		{{- end }}
+	})
+}
+`
+
+const tmplUnmarshalBSON = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) UnmarshalBSON(b []byte) error {
+	type Alias {{.Receiver}}{{.TypeParams}}
+	aux := struct {
+		Alias ` + "`bson:" + `",inline"` + "`" + `
+		{{- range .Aliases }}{{ if .Assign }}
+		{{.Field}} {{.Type}} ` + "`bson:" + `"{{.TargetKey}}"` + "`" + `
+		{{- end }}{{ end }}
+	}{
+		Alias: Alias(*{{.Recv}}),
+	}
+	if err := bson.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	*{{.Recv}} = {{.Receiver}}{{.TypeParams}}(aux.Alias)
+	{{- if .AssignErr }}
+	var err error
+	{{- end }}
+	{{- range .PlainAssigns }}
+	{{.}}
+	{{- end }}
+	return nil
+}
+`
+
+const tmplMarshalYAML = `func ({{.Recv}} {{.MarshalReceiver}}) MarshalYAML() (interface{}, error) {
+	{{- range .Prepares "return nil, err" }}
+	{{.}}
+	{{- end }}
+	type Alias {{.Receiver}}{{.TypeParams}}
+	return struct {
+		Alias ` + "`yaml:" + `",inline"` + "`" + `
+		{{- range .Aliases }}{{ if .Expr }}
+		{{.Field}} {{.MarshalType}} ` + "`yaml:" + `"{{.MarshalTargetKey}}"` + "`" + `
+		{{- end }}{{ end }}
+	}{
+		Alias: Alias({{.MarshalValue}}),
+		{{- range .Exprs }}
+		{{.}}
+		{{- end }}
+	}, nil
+}
+`
+
+const tmplUnmarshalYAML = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) UnmarshalYAML(value *yaml.Node) error {
+	type Alias {{.Receiver}}{{.TypeParams}}
+	aux := struct {
+		Alias ` + "`yaml:" + `",inline"` + "`" + `
+		{{- range .Aliases }}{{ if .Assign }}
+		{{.Field}} {{.Type}} ` + "`yaml:" + `"{{.TargetKey}}"` + "`" + `
+		{{- end }}{{ end }}
+	}{
+		Alias: Alias(*{{.Recv}}),
+	}
+	if err := value.Decode(&aux); err != nil {
+		return err
+	}
+	*{{.Recv}} = {{.Receiver}}{{.TypeParams}}(aux.Alias)
+	{{- if .AssignErr }}
+	var err error
+	{{- end }}
+	{{- range .PlainAssigns }}
+	{{.}}
+	{{- end }}
+	return nil
+}
+`
+
+const tmplMarshalYAMLNamed = `func ({{.Recv}} {{.MarshalReceiver}}) MarshalYAML() (interface{}, error) {
+	{{- with .Value }}{{ if .ExprErr }}
+	aux, err := {{.Expr}}
+	if err != nil {
+		return nil, err
+	}
+	return aux, nil
+	{{- else }}
+	return {{.Expr}}, nil
+	{{- end }}{{ end }}
+}
+`
+
+const tmplUnmarshalYAMLNamed = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) UnmarshalYAML(value *yaml.Node) error {
+	{{- with .Value }}
+	var aux {{.Type}}
+	if err := value.Decode(&aux); err != nil {
+		return err
+	}
+	{{- if .AssignErr }}
+	var err error
+	if *{{$.Recv}}, err = {{.Assign}}; err != nil {
+		return err
+	}
+	{{- else }}
+	*{{$.Recv}} = {{.Assign}}
+	{{- end }}{{ end }}
+	return nil
+}
+`
+
+const tmplMarshalXML = `func ({{.Recv}} {{.MarshalReceiver}}) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	{{- range .Prepares "return err" }}
+	{{.}}
+	{{- end }}
+	type Alias {{.Receiver}}{{.TypeParams}}
+	return e.EncodeElement(&struct {
+		*Alias
+		{{- range .Aliases }}{{ if .Expr }}
+		{{.Field}} {{.MarshalType}} ` + "`xml:" + `"{{.MarshalTargetKey}}"` + "`" + `
+		{{- end }}{{ end }}
+	}{
+		Alias: (*Alias)({{.MarshalPtr}}),
+		{{- range .Exprs }}
+		{{.}}
+		{{- end }}
+	}, start)
+}
+`
+
+const tmplUnmarshalXML = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type Alias {{.Receiver}}{{.TypeParams}}
+	aux := &struct {
+		*Alias
+		{{- range .Aliases }}{{ if .Assign }}
+		{{.Field}} {{.Type}} ` + "`xml:" + `"{{.TargetKey}}"` + "`" + `
+		{{- end }}{{ end }}
+	}{
+		Alias: (*Alias)({{.Recv}}),
+	}
+	if err := d.DecodeElement(aux, &start); err != nil {
+		return err
+	}
+	{{- if .AssignErr }}
+	var err error
+	{{- end }}
+	{{- range .PlainAssigns }}
+	{{.}}
+	{{- end }}
+	return nil
+}
+`
+
+const tmplMarshalXMLNamed = `func ({{.Recv}} {{.MarshalReceiver}}) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	{{- with .Value }}{{ if .ExprErr }}
+	aux, err := {{.Expr}}
+	if err != nil {
+		return err
+	}
+	return e.EncodeElement(aux, start)
+	{{- else }}
+	return e.EncodeElement({{.Expr}}, start)
+	{{- end }}{{ end }}
+}
+`
+
+const tmplUnmarshalXMLNamed = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	{{- with .Value }}
+	var aux {{.Type}}
+	if err := d.DecodeElement(&aux, &start); err != nil {
+		return err
+	}
+	{{- if .AssignErr }}
+	var err error
+	if *{{$.Recv}}, err = {{.Assign}}; err != nil {
+		return err
+	}
+	{{- else }}
+	*{{$.Recv}} = {{.Assign}}
+	{{- end }}{{ end }}
+	return nil
+}
+`
+
+const tmplEncodeMsgpack = `func ({{.Recv}} {{.MarshalReceiver}}) EncodeMsgpack(enc *msgpack.Encoder) error {
+	{{- range .Prepares "return err" }}
+	{{.}}
+	{{- end }}
+	type Alias {{.Receiver}}{{.TypeParams}}
+	return enc.Encode(&struct {
+		*Alias
+		{{- range .Aliases }}{{ if .Expr }}
+		{{.Field}} {{.MarshalType}} ` + "`msgpack:" + `"{{.MarshalTargetKey}}"` + "`" + `
+		{{- end }}{{ end }}
+	}{
+		Alias: (*Alias)({{.MarshalPtr}}),
+		{{- range .Exprs }}
+		{{.}}
+		{{- end }}
+	})
+}
+`
+
+const tmplDecodeMsgpack = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) DecodeMsgpack(dec *msgpack.Decoder) error {
+	type Alias {{.Receiver}}{{.TypeParams}}
+	aux := &struct {
+		*Alias
+		{{- range .Aliases }}{{ if .Assign }}
+		{{.Field}} {{.Type}} ` + "`msgpack:" + `"{{.TargetKey}}"` + "`" + `
+		{{- end }}{{ end }}
+	}{
+		Alias: (*Alias)({{.Recv}}),
+	}
+	if err := dec.Decode(aux); err != nil {
+		return err
+	}
+	{{- if .AssignErr }}
+	var err error
+	{{- end }}
+	{{- range .PlainAssigns }}
+	{{.}}
+	{{- end }}
+	return nil
+}
+`
+
+const tmplEncodeMsgpackNamed = `func ({{.Recv}} {{.MarshalReceiver}}) EncodeMsgpack(enc *msgpack.Encoder) error {
+	{{- with .Value }}{{ if .ExprErr }}
+	aux, err := {{.Expr}}
+	if err != nil {
+		return err
+	}
+	return enc.Encode(aux)
+	{{- else }}
+	return enc.Encode({{.Expr}})
+	{{- end }}{{ end }}
+}
+`
+
+const tmplDecodeMsgpackNamed = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) DecodeMsgpack(dec *msgpack.Decoder) error {
+	{{- with .Value }}
+	var aux {{.Type}}
+	if err := dec.Decode(&aux); err != nil {
+		return err
+	}
+	{{- if .AssignErr }}
+	var err error
+	if *{{$.Recv}}, err = {{.Assign}}; err != nil {
+		return err
+	}
+	{{- else }}
+	*{{$.Recv}} = {{.Assign}}
+	{{- end }}{{ end }}
+	return nil
+}
+`
+
+const tmplMarshalCBOR = `func ({{.Recv}} {{.MarshalReceiver}}) MarshalCBOR() ([]byte, error) {
+	{{- range .Prepares "return nil, err" }}
+	{{.}}
+	{{- end }}
+	type Alias {{.Receiver}}{{.TypeParams}}
+	return cbor.Marshal(&struct {
+		*Alias
+		{{- range .Aliases }}{{ if .Expr }}
+		{{.Field}} {{.MarshalType}} ` + "`cbor:" + `"{{.MarshalTargetKey}}"` + "`" + `
+		{{- end }}{{ end }}
+	}{
+		Alias: (*Alias)({{.MarshalPtr}}),
+		{{- range .Exprs }}
+		{{.}}
+		{{- end }}
+	})
+}
+`
+
+const tmplUnmarshalCBOR = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) UnmarshalCBOR(b []byte) error {
+	type Alias {{.Receiver}}{{.TypeParams}}
+	aux := &struct {
+		*Alias
+		{{- range .Aliases }}{{ if .Assign }}
+		{{.Field}} {{.Type}} ` + "`cbor:" + `"{{.TargetKey}}"` + "`" + `
+		{{- end }}{{ end }}
+	}{
+		Alias: (*Alias)({{.Recv}}),
+	}
+	if err := cbor.Unmarshal(b, aux); err != nil {
+		return err
+	}
+	{{- if .AssignErr }}
+	var err error
+	{{- end }}
+	{{- range .PlainAssigns }}
+	{{.}}
+	{{- end }}
+	return nil
+}
+`
+
+const tmplMarshalCBORNamed = `func ({{.Recv}} {{.MarshalReceiver}}) MarshalCBOR() ([]byte, error) {
+	{{- with .Value }}{{ if .ExprErr }}
+	aux, err := {{.Expr}}
+	if err != nil {
+		return nil, err
+	}
+	return cbor.Marshal(aux)
+	{{- else }}
+	return cbor.Marshal({{.Expr}})
+	{{- end }}{{ end }}
+}
+`
+
+const tmplUnmarshalCBORNamed = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) UnmarshalCBOR(b []byte) error {
+	{{- with .Value }}
+	var aux {{.Type}}
+	if err := cbor.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	{{- if .AssignErr }}
+	var err error
+	if *{{$.Recv}}, err = {{.Assign}}; err != nil {
+		return err
+	}
+	{{- else }}
+	*{{$.Recv}} = {{.Assign}}
+	{{- end }}{{ end }}
+	return nil
+}
+`
+
+// Value has a value receiver, as the implementations of driver.Valuer
+// usually do, so that database/sql calls it with values as well as
+// pointers, and takes nil pointers for NULL instead of calling it.
+const tmplValue = `func ({{.Recv}} {{.Receiver}}{{.TypeParams}}) Value() (driver.Value, error) {
+	{{- range .Prepares "return nil, err" }}
+	{{.}}
+	{{- end }}
+	{{- with index .Aliases 0 }}
+	aux := struct {
+		{{.Field}} {{.Type}}
+	}{
+	{{- end }}
+		{{- range .Exprs }}
+		{{.}}
+		{{- end }}
+	}
+	return aux.{{ (index .Aliases 0).Field }}, nil
+}
+`
+
+const tmplScan = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) Scan(src interface{}) error {
+	{{- $recv := .Receiver }}
+	{{- with index .Aliases 0 }}
+	var aux struct {
+		{{.Field}} {{.Type}}
+	}
+	switch src := src.(type) {
+	{{- if eq .Type "[]byte" }}
+	case []byte:
+		aux.{{.Field}} = append([]byte(nil), src...)
+	case string:
+		aux.{{.Field}} = []byte(src)
+	{{- else }}
+	case {{.Type}}:
+		aux.{{.Field}} = src
+	{{- if eq .Type "string" }}
+	case []byte:
+		aux.{{.Field}} = string(src)
+	{{- end }}
+	{{- end }}
+	default:
+		return fmt.Errorf("cannot scan %T into {{$recv}}", src)
+	}
+	{{- end }}
+	{{- if .AssignErr }}
+	var err error
+	{{- end }}
+	{{- range .PlainAssigns }}
+	{{.}}
+	{{- end }}
+	return nil
+}
+`
+
+const tmplValueNamed = `func ({{.Recv}} {{.Receiver}}{{.TypeParams}}) Value() (driver.Value, error) {
+	{{- with .Value }}{{ if .ExprErr }}
+	aux, err := {{$.ValueExpr}}
+	if err != nil {
+		return nil, err
+	}
+	return aux, nil
+	{{- else }}
+	return {{$.ValueExpr}}, nil
+	{{- end }}{{ end }}
+}
+`
+
+const tmplScanNamed = `func ({{.Recv}} *{{.Receiver}}{{.TypeParams}}) Scan(src interface{}) error {
+	{{- $recv := .Receiver }}
+	{{- with .Value }}
+	var aux {{.Type}}
+	switch src := src.(type) {
+	{{- if eq .Type "[]byte" }}
+	case []byte:
+		aux = append([]byte(nil), src...)
+	case string:
+		aux = []byte(src)
+	{{- else }}
+	case {{.Type}}:
+		aux = src
+	{{- if eq .Type "string" }}
+	case []byte:
+		aux = string(src)
+	{{- end }}
+	{{- end }}
+	default:
+		return fmt.Errorf("cannot scan %T into {{$recv}}", src)
+	}
+	{{- if .AssignErr }}
+	var err error
+	if *{{$.Recv}}, err = {{.Assign}}; err != nil {
+		return err
+	}
+	{{- else }}
+	*{{$.Recv}} = {{.Assign}}
+	{{- end }}{{ end }}
+	return nil
+}
+`
+
+// IsZero reports whether the value is marshaled with the zero values of
+// the keys, so that omitzero of json v2 and others agree with the
+// conversions. The errors of EXPR are not zero.
+const tmplIsZero = `func ({{.Recv}} {{.MarshalReceiver}}) IsZero() bool {
+	{{- range .Prepares "return false" }}
+	{{.}}
+	{{- end }}
+	return {{.ZeroConds}}
+}
+`
+
+const tmplIsZeroNamed = `func ({{.Recv}} {{.MarshalReceiver}}) IsZero() bool {
+	{{- with .Value }}{{ if .ExprErr }}
+	aux, err := {{.Expr}}
+	if err != nil {
+		return false
+	}
+	{{- else }}
+	aux := {{.Expr}}
+	{{- end }}{{ end }}
+	return {{.ValueZero}}
+}
+`
+
+// Equal reports whether the values are marshaled with the same values of
+// the keys, comparing the converted fields by their aliases, e.g. the
+// times marshaled by $.Unix() at second precision. The errors of EXPR are
+// not equal.
+const tmplEqual = `func ({{.Recv}} {{.MarshalReceiver}}) Equal(other {{.Receiver}}{{.TypeParams}}) bool {
+	{{- if .Exprs }}
+	convert := func({{.Recv}} {{.MarshalReceiver}}) (aux struct {
+		{{- range .Aliases }}{{ if .Expr }}
+		{{.Field}} {{.MarshalType}}
+		{{- end }}{{ end }}
+	}, ok bool) {
+		{{- range .Prepares "return aux, false" }}
+		{{.}}
+		{{- end }}
+		{{- range .EqualAssigns }}
+		{{.}}
+		{{- end }}
+		return aux, true
+	}
+	lhs, ok := convert({{.Recv}})
+	if !ok {
+		return false
+	}
+	rhs, ok := convert({{.OtherArg}})
+	if !ok {
+		return false
+	}
+	{{- end }}
+	return {{.EqualConds}}
+}
+`
+
+const tmplEqualNamed = `func ({{.Recv}} {{.MarshalReceiver}}) Equal(other {{.Receiver}}{{.TypeParams}}) bool {
+	{{- with .Value }}
+	convert := func({{$.Recv}} {{$.MarshalReceiver}}) (aux {{.Type}}, ok bool) {
+		{{- if .ExprErr }}
+		aux, err := {{.Expr}}
+		return aux, err == nil
+		{{- else }}
+		return {{.Expr}}, true
+		{{- end }}
+	}
+	{{- end }}
+	lhs, ok := convert({{.Recv}})
+	if !ok {
+		return false
+	}
+	rhs, ok := convert({{.OtherArg}})
+	if !ok {
+		return false
+	}
+	return {{.ValueEqual}}
+}
+`
+
+// String formats the value as the JSON of the json target, compacted by
+// json.Marshal, e.g. for logging.
+const tmplString = `func ({{.Recv}} {{.MarshalReceiver}}) String() string {
+	b, err := json.Marshal({{.Recv}})
+	if err != nil {
+		return "%!s(" + err.Error() + ")"
+	}
+	return string(b)
+}
+`
+
+// Clone copies the value deeply, so that it shares no memory of pointers,
+// slices, maps or arrays of them with the receiver.
+const tmplClone = `func ({{.Recv}} {{.MarshalReceiver}}) Clone() *{{.Receiver}}{{.TypeParams}} {
+	{{- if not .ValueReceiver }}
+	if {{.Recv}} == nil {
+		return nil
+	}
+	{{- end }}
+	clone := {{.MarshalValue}}
+	{{- range .CloneStmts }}
+	{{.}}
+	{{- end }}
+	return &clone
+}
+`
@@ -0,0 +1,110 @@
+package generator
+
+import "testing"
+
+func TestValueReceiver(t *testing.T) {
+	const src = `package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+type User struct {
+	Name string ` + "`json:\"-\" customjson:\"name=\\\"x\\\"+$;$[1:]\"`" + `
+}
+
+//encjsongen:marshal "x"+string($);Code($[1:])
+type Code string
+
+// conn prints the arguments of Exec, converted by database/sql.
+type conn struct{}
+
+func (conn) Open(string) (driver.Conn, error)        { return conn{}, nil }
+func (conn) Prepare(string) (driver.Stmt, error)     { return nil, errors.New("not supported") }
+func (conn) Close() error                            { return nil }
+func (conn) Begin() (driver.Tx, error)               { return nil, errors.New("not supported") }
+func (conn) ExecContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Result, error) {
+	fmt.Printf("%#v\n", args[0].Value)
+	return driver.RowsAffected(0), nil
+}
+
+func main() {
+	sql.Register("conn", conn{})
+	db, err := sql.Open("conn", "")
+	if err != nil {
+		panic(err)
+	}
+	for _, v := range []interface{}{
+		User{Name: "a"},
+		&User{Name: "a"},
+		(*User)(nil),
+		Code("b"),
+		new(Code),
+		(*Code)(nil),
+	} {
+		if _, err := db.Exec("", v); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+`
+	got := run(t, src, Options{Targets: []string{"sql"}})
+	want := `"xa"
+"xa"
+<nil>
+"xb"
+"x"
+<nil>
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestString(t *testing.T) {
+	const src = `package main
+
+import "fmt"
+
+type User struct {
+	Name  string
+	Score int ` + "`json:\"-\" customjson:\"score=$ * 10;$ / 10\"`" + `
+}
+
+type Handler struct {
+	F    func()
+	Name string ` + "`json:\"-\" customjson:\"name=$;$\"`" + `
+}
+
+func main() {
+	u := User{Name: "a", Score: 1}
+	fmt.Println(&u, u)
+	fmt.Printf("%v %s\n", []*User{&u}, &Handler{})
+}
+`
+	for _, tt := range []struct {
+		opts Options
+		want string
+	}{
+		{
+			opts: Options{Targets: []string{"json", "string"}},
+			want: `{"Name":"a","score":10} {a 1}
+[{"Name":"a","score":10}] %!s(json: error calling MarshalJSON for type *main.Handler: json: unsupported type: func())
+`,
+		},
+		{
+			opts: Options{Targets: []string{"json", "string"}, ValueReceiver: true},
+			want: `{"Name":"a","score":10} {"Name":"a","score":10}
+[{"Name":"a","score":10}] %!s(json: error calling MarshalJSON for type *main.Handler: json: unsupported type: func())
+`,
+		},
+	} {
+		if got := run(t, src, tt.opts); got != tt.want {
+			t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"text/template"
+)
+
+// Template names of Options.Templates, replacing the templates of the
+// struct types of -target=json.
+//
+// The templates are executed with the *structInfo of each type, whose
+// following fields and methods are kept stable for them:
+//
+//	.Recv             the receiver name, e.g. v
+//	.Receiver         the type name, e.g. User
+//	.TypeParams       the type parameters, e.g. [T], or empty
+//	.MarshalReceiver  the receiver type of the marshaling methods, e.g. *User or User
+//	.MarshalPtr       the receiver as a pointer, e.g. v or &v
+//	.MarshalPool      the sync.Pool of the alias structs of MarshalJSON, or empty for generic types
+//	.BeforeMarshal    whether the type has BeforeMarshalJSON() error
+//	.AfterUnmarshal   whether the type has AfterUnmarshalJSON() error
+//	.Strict           whether unknown keys are rejected
+//	.Reset            whether the receiver is zeroed before unmarshaling
+//	.UseNumber        whether the numbers of interface values are decoded as json.Number
+//	.Prepares RET     the statements preceding .Exprs, returning by RET on errors
+//	.Exprs            the alias fields of the marshaled struct literal, e.g. CreateTime: v.CreateTime.Unix(),
+//	.InlineTypes BOOL the aliases of the inline structs, of marshaling if BOOL
+//	.NeedsKeys        whether the keys map is needed by .Required and .Assigns
+//	.LookupKeys       the keys looked up in the keys map, e.g. "a", "b", which the keys equal under case-folding are copied to
+//	.Required         the keys UnmarshalJSON fails without
+//	.AssignErr        whether .Assigns set the variable err
+//	.Assigns          the statements setting the fields from aux
+//	.Validates        the statements checking the fields after .Assigns
+//	.Aliases          the converted fields, of which
+//	    .Target         the name of the field, or virtualN of the Nth encjsongen:virtual directive
+//	    .Field          the name of the alias field
+//	    .Type           the alias type
+//	    .JSONKey        the json tag of the alias field, e.g. createTime,omitempty
+//	    .Key            the JSON key
+//	    .Expr           EXPR, or empty if the field is not marshaled
+//	    .Assign         ASSIGN, or its right hand side if it sets fields, or empty if the field is not unmarshaled
+//	    .MarshalDecl    the declaration of the alias field of marshaling
+//	    .UnmarshalDecl  the declaration of the alias field of unmarshaling
+const (
+	templateMarshalJSON   = "MarshalJSON"
+	templateUnmarshalJSON = "UnmarshalJSON"
+)
+
+// overrideTemplates returns a copy of the json target t whose templates of
+// struct types are replaced by tmpls, which are parsed to report their
+// errors before any type is generated.
+func overrideTemplates(t *target, tmpls map[string]string) (*target, error) {
+	names := make([]string, 0, len(tmpls))
+	for name := range tmpls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	o := *t
+	for _, name := range names {
+		tmpl := tmpls[name]
+		switch name {
+		case templateMarshalJSON:
+			o.marshal = tmpl
+		case templateUnmarshalJSON:
+			o.unmarshal = tmpl
+		default:
+			return nil, fmt.Errorf("unknown template %q; want %s or %s", name, templateMarshalJSON, templateUnmarshalJSON)
+		}
+		if _, err := template.New(name).Parse(tmpl); err != nil {
+			return nil, err
+		}
+	}
+	return &o, nil
+}
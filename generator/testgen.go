@@ -0,0 +1,264 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/types"
+	"strings"
+	"text/template"
+)
+
+// hasTests reports whether any of the options generating "_test.go" files
+// is set.
+func (g *Generator) hasTests() bool {
+	return g.opts.GenTests || g.opts.GenBenchmarks || g.opts.GenFuzz
+}
+
+// testFilename returns the path of the test file generated next to
+// filename.
+func testFilename(filename string) string {
+	return strings.TrimSuffix(filename, ".go") + "_test.go"
+}
+
+// tests returns the source of filename generated with the tests,
+// benchmarks and fuzz tests of infos, or nil if there are none.
+func (g *Generator) tests(filename string, infos []*structInfo) ([]byte, error) {
+	b := new(bytes.Buffer)
+	if err := writeHeader(b, infos, g.fileOptions); err != nil {
+		return nil, err
+	}
+	for _, spec := range targets["json"].imports(&g.opts) {
+		fmt.Fprintf(b, "import %s\n", spec)
+	}
+	n := b.Len()
+	for _, si := range infos {
+		if err := si.RenderTests(b); err != nil {
+			return nil, err
+		}
+	}
+	if b.Len() == n {
+		return nil, nil
+	}
+	return g.format(filename, b.Bytes())
+}
+
+// RenderTests writes the tests, benchmarks and fuzz tests of si to b. Generic types
+// are skipped since they have no type arguments to instantiate with.
+func (si *structInfo) RenderTests(b *bytes.Buffer) error {
+	if si.TypeParams != "" {
+		return nil
+	}
+	var tmpls []string
+	if si.opts.GenTests && si.HasMarshal() && si.HasUnmarshal() {
+		tmpls = append(tmpls, tmplRoundTrip)
+	}
+	if si.opts.GenBenchmarks && si.HasMarshal() {
+		tmpls = append(tmpls, tmplBenchmarkMarshal)
+		if si.HasUnmarshal() {
+			tmpls = append(tmpls, tmplBenchmarkUnmarshal)
+		}
+	}
+	if si.opts.GenFuzz && si.HasUnmarshal() {
+		tmpls = append(tmpls, tmplFuzzUnmarshal)
+	}
+	for _, tmpl := range tmpls {
+		if err := template.Must(template.New("test").Parse(tmpl)).Execute(b, si); err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "\n")
+	}
+	return nil
+}
+
+// Sample returns a value of si with a representative value in each
+// converted field. Fields only marshaled are left zero if si is also
+// unmarshaled, as they would not survive a round trip.
+func (si *structInfo) Sample() string {
+	if si.Value != nil {
+		if v, ok := si.sampleValue(si.typ, 0); ok {
+			return v
+		}
+		return "*new(" + si.Receiver + ")"
+	}
+	if si.Enum != nil {
+		return si.Enum[0].Const
+	}
+	if si.OneOf != nil {
+		// The first variant is set.
+		f := si.OneOf[0]
+		v, ok := si.sampleValue(f.typ, 0)
+		if !ok {
+			v = "new(" + si.typeString(f.typ.Underlying().(*types.Pointer).Elem()) + ")"
+		}
+		return si.Receiver + "{\n" + f.Name + ": " + v + ",\n}"
+	}
+	var fields []string
+	for _, a := range si.Aliases {
+		if a.Expr == "" || a.virtual || (a.Assign == "" && si.HasUnmarshal()) {
+			continue
+		}
+		if a.sample != "" {
+			if a.Kind == "" {
+				fields = append(fields, fmt.Sprintf("%s: %s,\n", a.Target, a.sample))
+			}
+			continue
+		}
+		if v, ok := si.sampleValue(a.fieldType, 0); ok {
+			fields = append(fields, fmt.Sprintf("%s: %s,\n", a.Target, v))
+		}
+	}
+	return si.Receiver + "{\n" + strings.Join(fields, "") + "}"
+}
+
+// maxSampleDepth limits the nesting of struct values in samples.
+const maxSampleDepth = 3
+
+// sampleValue returns an expression of a non-zero value of t, or false if
+// t has none which can be written in the generated file.
+func (si *structInfo) sampleValue(t types.Type, depth int) (string, bool) {
+	if n, ok := t.(*types.Named); ok {
+		obj := n.Obj()
+		if obj.Pkg() != nil && obj.Pkg().Path() == "time" && obj.Name() == "Time" {
+			return "time.Unix(1600000000, 0)", true
+		}
+		if obj.Pkg() != si.pkg && !obj.Exported() {
+			return "", false
+		}
+	}
+	typ := si.typeString(t)
+	_, named := t.(*types.Named)
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		var lit string
+		switch info := u.Info(); {
+		case info&types.IsBoolean != 0:
+			lit = "true"
+		case info&types.IsInteger != 0:
+			lit = "1"
+		case info&types.IsFloat != 0:
+			lit = "1.5"
+		case info&types.IsComplex != 0:
+			lit = "1i"
+		case info&types.IsString != 0:
+			lit = "`a`"
+		default:
+			return "", false
+		}
+		if named {
+			return typ + "(" + lit + ")", true
+		}
+		return lit, true
+	case *types.Slice:
+		elem, ok := si.sampleValue(u.Elem(), depth)
+		if !ok {
+			return "", false
+		}
+		return typ + "{" + elem + "}", true
+	case *types.Array:
+		elem, ok := si.sampleValue(u.Elem(), depth)
+		if !ok || u.Len() == 0 {
+			return "", false
+		}
+		return typ + "{" + elem + "}", true
+	case *types.Map:
+		key, ok := si.sampleValue(u.Key(), depth)
+		if !ok {
+			return "", false
+		}
+		elem, ok := si.sampleValue(u.Elem(), depth)
+		if !ok {
+			return "", false
+		}
+		return typ + "{" + key + ": " + elem + "}", true
+	case *types.Pointer:
+		elem, ok := si.sampleValue(u.Elem(), depth)
+		if !ok {
+			return "", false
+		}
+		elemType := si.typeString(u.Elem())
+		return "func() *" + elemType + " { v := new(" + elemType + "); *v = " + elem + "; return v }()", true
+	case *types.Struct:
+		if depth >= maxSampleDepth {
+			return typ + "{}", true
+		}
+		var fields []string
+		for i := 0; i < u.NumFields(); i++ {
+			f := u.Field(i)
+			if !f.Exported() && f.Pkg() != si.pkg {
+				continue
+			}
+			if v, ok := si.sampleValue(f.Type(), depth+1); ok {
+				fields = append(fields, f.Name()+": "+v)
+			}
+		}
+		return typ + "{" + strings.Join(fields, ", ") + "}", true
+	}
+	return "", false
+}
+
+const tmplRoundTrip = `func Test{{.Receiver}}JSONRoundTrip(t *testing.T) {
+	v := {{.Sample}}
+	b, err := json.Marshal(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got {{.Receiver}}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	b2, err := json.Marshal(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, b2) {
+		t.Errorf("round trip of %s: got %s", b, b2)
+	}
+}
+`
+
+const tmplBenchmarkMarshal = `func Benchmark{{.Receiver}}MarshalJSON(b *testing.B) {
+	v := {{.Sample}}
+	b.ReportAllocs()
+	for i := 0; i != b.N; i++ {
+		if _, err := json.Marshal(&v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+`
+
+const tmplBenchmarkUnmarshal = `func Benchmark{{.Receiver}}UnmarshalJSON(b *testing.B) {
+	v := {{.Sample}}
+	data, err := json.Marshal(&v)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i != b.N; i++ {
+		var got {{.Receiver}}
+		if err := json.Unmarshal(data, &got); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+`
+
+// The fuzz test only looks for panics, since arbitrary input is mostly
+// rejected by UnmarshalJSON.
+const tmplFuzzUnmarshal = `func Fuzz{{.Receiver}}UnmarshalJSON(f *testing.F) {
+	{{- if .HasMarshal }}
+	v := {{.Sample}}
+	b, err := json.Marshal(&v)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(b)
+	{{- end }}
+	f.Add([]byte(` + "`{}`" + `))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var v {{.Receiver}}
+		_ = json.Unmarshal(b, &v)
+	})
+}
+`
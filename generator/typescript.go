@@ -0,0 +1,96 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// typeScriptFile returns TypeScript declarations of the JSON encoding of
+// infos, translated from their schemas.
+func typeScriptFile(infos []*structInfo) ([]byte, error) {
+	b := newSchemaBuilder(infos[0].pkg, infos, tsName)
+	for _, si := range infos {
+		b.define(si)
+	}
+	names := make([]string, 0, len(b.defs))
+	for name := range b.defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "// %s\n", GeneratedMarker)
+	for _, name := range names {
+		s := b.defs[name]
+		fmt.Fprintf(buf, "\n")
+		if s.Properties == nil || s.Type != "object" {
+			fmt.Fprintf(buf, "export type %s = %s;\n", tsName(name), tsType(s))
+			continue
+		}
+		fmt.Fprintf(buf, "export interface %s {\n", tsName(name))
+		for _, p := range tsProperties(s) {
+			fmt.Fprintf(buf, "  %s;\n", p)
+		}
+		fmt.Fprintf(buf, "}\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// tsName returns the TypeScript identifier of a type named name in
+// schemas, which may be qualified by a package name.
+func tsName(name string) string {
+	return strings.NewReplacer(".", "_", "[", "_", "]", "", ",", "_", " ", "").Replace(name)
+}
+
+// tsType returns the TypeScript type of s, whose references are already
+// TypeScript identifiers.
+func tsType(s *schema) string {
+	switch {
+	case s.Ref != "":
+		return s.Ref
+	case s.Type == "string":
+		return "string"
+	case s.Type == "integer", s.Type == "number":
+		return "number"
+	case s.Type == "boolean":
+		return "boolean"
+	case s.Type == "array":
+		elem := tsType(s.Items)
+		if !tsIdent.MatchString(elem) {
+			return "Array<" + elem + ">"
+		}
+		return elem + "[]"
+	case s.Type == "object" && s.AdditionalProperties != nil:
+		return "Record<string, " + tsType(s.AdditionalProperties) + ">"
+	case s.Type == "object":
+		return "{ " + strings.Join(tsProperties(s), "; ") + " }"
+	}
+	return "unknown"
+}
+
+var tsIdent = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// tsProperties returns the property signatures of an object schema s in
+// the order of the fields. Keys which are not required are optional.
+func tsProperties(s *schema) []string {
+	required := make(map[string]bool)
+	for _, key := range s.Required {
+		required[key] = true
+	}
+	var props []string
+	for _, key := range s.keys {
+		name := key
+		if !tsIdent.MatchString(name) {
+			name = strconv.Quote(name)
+		}
+		if !required[key] {
+			name += "?"
+		}
+		props = append(props, name+": "+tsType(s.Properties[key]))
+	}
+	return props
+}
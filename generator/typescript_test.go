@@ -0,0 +1,30 @@
+package generator
+
+import "testing"
+
+func TestTypeScriptFile(t *testing.T) {
+	got := generatedFile(t, schemaSrc, Options{TSOut: "types.d.ts"}, "types.d.ts")
+	const want = `// Code generated by encjsongen. DO NOT EDIT.
+
+export interface Group {
+  id: number;
+  users: User[];
+}
+
+export interface Meta {
+  data: string;
+}
+
+export interface User {
+  createTime: number;
+  name: string;
+  age?: number;
+  tags: string[];
+  group?: Group;
+  meta: Meta;
+}
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
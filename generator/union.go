@@ -0,0 +1,188 @@
+package generator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// kindUnion is the conversion of an interface field by
+// "union(NAME:TYPE,...)", which marshals its dynamic value with the NAME of
+// its TYPE under unionKey, and unmarshals the TYPE of the NAME there.
+const kindUnion = "union"
+
+// unionKey is the key of the names of the types in the objects.
+const unionKey = "type"
+
+// unionCase is a type of a union.
+type unionCase struct {
+	name string // under unionKey
+	typ  string // as written in the generated file
+	elem string // of typ if it is a pointer
+}
+
+// isUnion reports whether conv is "union(...)".
+func isUnion(conv string) bool {
+	return strings.HasPrefix(conv, kindUnion+"(") && strings.HasSuffix(conv, ")")
+}
+
+// parseUnion returns the alias of the field of type t converted by conv,
+// which isUnion.
+func (si *structInfo) parseUnion(conv string, t types.Type) (alias, error) {
+	var a alias
+	if _, ok := t.Underlying().(*types.Interface); !ok {
+		return a, fmt.Errorf("union(...) requires an interface field, but got %s", si.typeString(t))
+	}
+	names := make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, c := range splitTopLevel(conv[len(kindUnion)+1 : len(conv)-1]) {
+		i := strings.Index(c, ":")
+		if i <= 0 || i == len(c)-1 {
+			return a, fmt.Errorf("invalid union: %q is not NAME:TYPE", c)
+		}
+		name, expr := c[:i], strings.TrimSpace(c[i+1:])
+		if names[name] {
+			return a, fmt.Errorf("invalid union: duplicate name %q", name)
+		}
+		names[name] = true
+		tv, err := types.Eval(si.fset, si.pkg, si.evalPos(), expr)
+		if err != nil {
+			return a, fmt.Errorf("invalid union: %v", err)
+		}
+		if !tv.IsType() {
+			return a, fmt.Errorf("invalid union: %s is not a type", expr)
+		}
+		if types.IsInterface(tv.Type) || !types.AssignableTo(tv.Type, t) {
+			return a, fmt.Errorf("invalid union: %s does not implement %s", expr, si.typeString(t))
+		}
+		typ := si.typeString(tv.Type)
+		if seen[typ] {
+			return a, fmt.Errorf("invalid union: duplicate type %s", typ)
+		}
+		seen[typ] = true
+		uc := unionCase{name: name, typ: typ}
+		if p, ok := tv.Type.(*types.Pointer); ok {
+			uc.elem = si.typeString(p.Elem())
+		}
+		a.union = append(a.union, uc)
+	}
+	if len(a.union) == 0 {
+		return a, errors.New("invalid union: no types")
+	}
+	a.Type = "json.RawMessage"
+	a.aliasType = rawMessage
+	a.Expr, a.Assign = conv, conv
+	return a, nil
+}
+
+// splitTopLevel splits s by the commas out of brackets, such as of the type
+// arguments, into none if s is blank.
+func splitTopLevel(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	var (
+		parts []string
+		depth int
+		start int
+	)
+	for i, r := range s {
+		switch r {
+		case '[', '(', '{':
+			depth++
+		case ']', ')', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unionPrepare returns the statement binding the JSON of the field of a to
+// its alias variable, returning by ret on errors.
+func (si *structInfo) unionPrepare(a alias, ret string) string {
+	x := si.Recv + "." + a.Target
+	var cases []string
+	for _, c := range a.union {
+		name, _ := json.Marshal(c.name)
+		head := "{" + strconv.Quote(unionKey) + ":" + string(name)
+		lit := "`" + head + "`"
+		if strings.Contains(head, "`") {
+			lit = strconv.Quote(head)
+		}
+		cases = append(cases, fmt.Sprintf("case %s:\nkey = %s", c.typ, lit))
+	}
+	return fmt.Sprintf(`var alias%[1]s json.RawMessage
+if %[2]s != nil {
+var key string
+switch %[2]s.(type) {
+%[3]s
+}
+b, err := json.Marshal(%[2]s)
+if err == nil && key == "" {
+err = fmt.Errorf(%[4]s, %[2]s)
+}
+if err == nil && (len(b) < 2 || b[0] != '{') {
+err = fmt.Errorf(%[5]s, %[2]s)
+}
+if err != nil {
+%[6]s
+}
+if len(b) > 2 {
+key += ","
+}
+alias%[1]s = append([]byte(key), b[1:]...)
+}`, a.Target, x, strings.Join(cases, "\n"),
+		si.unionFormat("%T of {key} is not in its union", a), si.unionFormat("%T of {key} is not marshaled to an object", a), ret)
+}
+
+// unionAssign returns the statement setting the field of a to the value
+// of the type named in its JSON.
+func (si *structInfo) unionAssign(a alias) string {
+	x := si.Recv + "." + a.Target
+	var cases []string
+	for _, c := range a.union {
+		elem, value := c.elem, "e"
+		if elem == "" {
+			elem, value = c.typ, "*e"
+		}
+		cases = append(cases, fmt.Sprintf(`case %s:
+e := new(%s)
+if err := json.Unmarshal(aux.%s, e); err != nil {
+return err
+}
+%s = %s`, strconv.Quote(c.name), elem, a.Field, x, value))
+	}
+	return fmt.Sprintf(`%[1]s = nil
+if len(aux.%[2]s) != 0 && string(aux.%[2]s) != "null" {
+var head struct {
+Type *string `+"`json:%[3]q`"+`
+}
+if err := json.Unmarshal(aux.%[2]s, &head); err != nil {
+return err
+}
+if head.Type == nil {
+return errors.New(%[4]s)
+}
+switch *head.Type {
+%[5]s
+default:
+return fmt.Errorf(%[6]s, *head.Type)
+}
+}`, x, a.Field, unionKey, strconv.Quote(si.Receiver+": missing "+unionKey+" of "+a.Key()), strings.Join(cases, "\n"),
+		si.unionFormat("unknown "+unionKey+" %q of {key}", a))
+}
+
+// unionFormat returns the quoted format of the errors of a, prefixed by the
+// type name, in which "{key}" is replaced by its key.
+func (si *structInfo) unionFormat(format string, a alias) string {
+	key := strings.Replace(a.Key(), "%", "%%", -1)
+	return strconv.Quote(si.Receiver + ": " + strings.Replace(format, "{key}", key, -1))
+}
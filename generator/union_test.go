@@ -0,0 +1,123 @@
+package generator
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnion(t *testing.T) {
+	const src = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type Shape interface{ Area() float64 }
+
+type Circle struct {
+	R float64 ` + "`json:\"r\"`" + `
+}
+
+func (c Circle) Area() float64 { return 3 * c.R * c.R }
+
+type Square struct {
+	Side float64 ` + "`json:\"side\"`" + `
+}
+
+func (s *Square) Area() float64 { return s.Side * s.Side }
+
+type Point struct{}
+
+func (Point) Area() float64 { return 0 }
+
+type Triangle struct{}
+
+func (*Triangle) Area() float64 { return 0 }
+
+type Drawing struct {
+	Shape Shape ` + "`json:\"-\" customjson:\"shape=union(circle:Circle,square:*Square,point:Point)\"`" + `
+}
+
+func main() {
+	for _, v := range []Drawing{
+		{Shape: Circle{R: 1}},
+		{Shape: &Square{Side: 2}},
+		{Shape: Point{}},
+		{},
+		{Shape: &Triangle{}},
+	} {
+		b, err := json.Marshal(&v)
+		fmt.Println(string(b), err)
+	}
+	for _, in := range []string{
+		"{\"shape\":{\"type\":\"circle\",\"r\":1}}",
+		"{\"shape\":{\"side\":2,\"type\":\"square\"}}",
+		"{\"shape\":{\"type\":\"point\"}}",
+		"{\"shape\":null}",
+		"{\"shape\":{\"r\":1}}",
+		"{\"shape\":{\"type\":\"triangle\"}}",
+	} {
+		var v Drawing
+		err := json.Unmarshal([]byte(in), &v)
+		fmt.Printf("%T %v %v\n", v.Shape, v.Shape, err)
+	}
+}
+`
+	const want = `{"shape":{"type":"circle","r":1}} <nil>
+{"shape":{"type":"square","side":2}} <nil>
+{"shape":{"type":"point"}} <nil>
+{"shape":null} <nil>
+ json: error calling MarshalJSON for type *main.Drawing: Drawing: *main.Triangle of shape is not in its union
+main.Circle {1} <nil>
+*main.Square &{2} <nil>
+main.Point {} <nil>
+<nil> <nil> <nil>
+<nil> <nil> Drawing: missing type of shape
+<nil> <nil> Drawing: unknown type "triangle" of shape
+`
+	for _, mode := range []string{"reflect", "direct"} {
+		if got := run(t, src, Options{Mode: mode}); got != want {
+			t.Errorf("-mode=%s: got\n%s\nwant\n%s", mode, got, want)
+		}
+	}
+}
+
+func TestUnionInvalid(t *testing.T) {
+	const src = `package main
+
+type Shape interface{ Area() float64 }
+
+type Circle struct{}
+
+func (Circle) Area() float64 { return 0 }
+
+type Square struct{}
+
+func (*Square) Area() float64 { return 0 }
+
+type Drawing struct {
+	Shape Shape ` + "`json:\"-\" customjson:\"shape=%s\"`" + `
+	Name  string
+}
+`
+	for _, tt := range []struct {
+		conv string
+		want string
+	}{
+		{conv: "union(circle:Circle,square:Square)", want: "invalid union: Square does not implement Shape"},
+		{conv: "union(circle:Circle,circle:*Square)", want: `invalid union: duplicate name "circle"`},
+		{conv: "union(circle:Circle,round:Circle)", want: "invalid union: duplicate type Circle"},
+		{conv: "union(circle)", want: `invalid union: "circle" is not NAME:TYPE`},
+		{conv: "union()", want: "invalid union: no types"},
+	} {
+		t.Run(tt.conv, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "main.go")
+			_, diags := generate(t, filename, strings.Replace(src, "%s", tt.conv, 1), Options{})
+			if len(diags) != 1 || !strings.Contains(diags[0], tt.want) {
+				t.Errorf("got %q, want %q", diags, tt.want)
+			}
+		})
+	}
+}
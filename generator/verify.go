@@ -0,0 +1,123 @@
+package generator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// verify type checks the Go files of files, except tests, with the source
+// files of pkg other than those generated by encjsongen, which they
+// replace, and returns the error of each file failing. The packages not
+// imported by pkg, directly or indirectly, such as fmt of the oneof types,
+// and those only partially known as the dependencies of the imported ones
+// are imported from the export data of the compiler, and the errors of the
+// uses of those failing to be imported are not reported.
+func verify(pkg *Package, files []File) map[string]error {
+	var (
+		syntax []*ast.File
+		names  = make(map[*ast.File]string)
+		errs   = make(map[string]error)
+	)
+	for _, f := range pkg.Syntax {
+		if !isGenerated(f) {
+			syntax = append(syntax, f)
+		}
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name, ".go") || strings.HasSuffix(file.Name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(pkg.Fset, file.Name, file.Content, parser.ParseComments)
+		if err != nil {
+			errs[file.Name] = err
+			continue
+		}
+		syntax = append(syntax, f)
+		names[f] = file.Name
+	}
+	if len(names) == 0 {
+		return errs
+	}
+
+	known := make(map[string]*types.Package)
+	var add func(p *types.Package)
+	add = func(p *types.Package) {
+		if _, ok := known[p.Path()]; ok || !p.Complete() {
+			return
+		}
+		known[p.Path()] = p
+		for _, imported := range p.Imports() {
+			add(imported)
+		}
+	}
+	for _, imported := range pkg.Types.Imports() {
+		add(imported)
+	}
+	var (
+		fallback = importer.Default()
+		failed   = make(map[string]bool)
+	)
+	conf := types.Config{
+		Importer: importerFunc(func(path string) (*types.Package, error) {
+			if p, ok := known[path]; ok {
+				return p, nil
+			}
+			p, err := fallback.Import(path)
+			if err != nil {
+				failed[path[strings.LastIndex(path, "/")+1:]] = true
+				return nil, fmt.Errorf("%s is not imported by the package: %v", path, err)
+			}
+			known[path] = p
+			return p, nil
+		}),
+		Error: func(err error) {
+			te, ok := err.(types.Error)
+			if !ok || strings.HasPrefix(te.Msg, "could not import") {
+				return
+			}
+			if name := strings.TrimPrefix(te.Msg, "undefined: "); name != te.Msg && failed[name] {
+				return
+			}
+			name := te.Fset.Position(te.Pos).Filename
+			for _, generated := range names {
+				if name == generated && errs[name] == nil {
+					errs[name] = err
+				}
+			}
+		},
+	}
+	conf.Check(pkg.Types.Path(), pkg.Fset, syntax, nil)
+	return errs
+}
+
+// dropInvalid returns files except the Go files failing verify, which are
+// reported by failed, and their tests.
+func dropInvalid(pkg *Package, files []File, failed func(pos token.Pos, err error)) []File {
+	errs := verify(pkg, files)
+	if len(errs) == 0 {
+		return files
+	}
+	var valid []File
+	for _, file := range files {
+		if err, ok := errs[file.Name]; ok {
+			failed(file.Pos, err)
+			continue
+		}
+		if _, ok := errs[strings.TrimSuffix(file.Name, "_test.go")+".go"]; ok && strings.HasSuffix(file.Name, "_test.go") {
+			continue
+		}
+		valid = append(valid, file)
+	}
+	return valid
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) {
+	return f(path)
+}
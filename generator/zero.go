@@ -0,0 +1,120 @@
+package generator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"strings"
+)
+
+// ZeroConds returns the condition of IsZero, under which every field
+// encoded by MarshalJSON has the zero value, seen through the aliases for
+// the converted fields.
+func (si *structInfo) ZeroConds() string {
+	var conds []string
+	inlined := make(map[*alias]bool)
+	for _, f := range si.wireFields(true) {
+		if a := f.alias; a != nil {
+			// The inline values are seen as a whole.
+			if inlined[a] {
+				continue
+			}
+			inlined[a] = a.Inline()
+			// Prepares binds the values under omitif to the pointers left
+			// nil if omitted.
+			if a.OmitIf != "" {
+				conds = append(conds, fmt.Sprintf("(omit%[1]s == nil || %[2]s)", a.Target, si.zeroCond("*omit"+a.Target, a.aliasType)))
+			} else {
+				conds = append(conds, si.zeroCond(a.value(), a.aliasType))
+			}
+			continue
+		}
+		// The fields are absent through the nil embedded pointers.
+		var nils []string
+		x := si.Recv
+		for _, e := range f.path[:len(f.path)-1] {
+			x += "." + e.Name()
+			if _, ok := e.Type().Underlying().(*types.Pointer); ok {
+				nils = append(nils, x+" == nil")
+			}
+		}
+		cond := si.zeroCond(f.selector(si.Recv), f.typ)
+		if len(nils) > 0 {
+			cond = "(" + strings.Join(append(nils, cond), " || ") + ")"
+		}
+		conds = append(conds, cond)
+	}
+	if len(conds) == 0 {
+		return "true"
+	}
+	return strings.Join(conds, " &&\n")
+}
+
+// ValueZero returns the condition of IsZero of a named non-struct type,
+// whose value converted is bound to aux.
+func (si *structInfo) ValueZero() string {
+	return si.zeroCond("aux", si.Value.aliasType)
+}
+
+// primary returns x parenthesized unless it is an operand or a primary
+// expression, for the operators of zeroCond binding tighter than the
+// comparisons.
+func primary(x string) string {
+	switch e, _ := parser.ParseExpr(x); e.(type) {
+	case *ast.Ident, *ast.BasicLit, *ast.CompositeLit, *ast.ParenExpr, *ast.SelectorExpr, *ast.IndexExpr, *ast.CallExpr:
+		return x
+	}
+	return "(" + x + ")"
+}
+
+// zeroCond returns the condition under which x of type t is zero, by its
+// IsZero method if any as json v2 does for omitzero.
+func (si *structInfo) zeroCond(x string, t types.Type) string {
+	if _, ok := t.(*types.TypeParam); ok {
+		return fmt.Sprintf("reflect.ValueOf(%s).IsZero()", x)
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Pointer, *types.Slice, *types.Map, *types.Chan, *types.Signature, *types.Interface:
+		return x + " == nil"
+	case *types.Basic:
+		if hasIsZero(t) {
+			break
+		}
+		switch info := u.Info(); {
+		case info&types.IsBoolean != 0:
+			return "!" + primary(x)
+		case info&types.IsString != 0:
+			return x + ` == ""`
+		case u.Kind() == types.UnsafePointer:
+			return x + " == nil"
+		default:
+			return x + " == 0"
+		}
+	}
+	switch {
+	case hasIsZero(t):
+		return primary(x) + ".IsZero()"
+	case types.Comparable(t):
+		return fmt.Sprintf("%s == *new(%s)", x, si.typeString(t))
+	}
+	return fmt.Sprintf("reflect.ValueOf(%s).IsZero()", x)
+}
+
+// hasIsZero reports whether the values of t have the method IsZero() bool.
+func hasIsZero(t types.Type) bool {
+	sel := types.NewMethodSet(t).Lookup(nil, "IsZero")
+	if sel == nil {
+		return false
+	}
+	m, ok := sel.Obj().(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := m.Type().(*types.Signature)
+	if sig.Params().Len() != 0 || sig.Results().Len() != 1 {
+		return false
+	}
+	b, ok := sig.Results().At(0).Type().(*types.Basic)
+	return ok && b.Kind() == types.Bool
+}
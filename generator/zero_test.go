@@ -0,0 +1,61 @@
+package generator
+
+import "testing"
+
+func TestIsZero(t *testing.T) {
+	const src = `package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type Base struct {
+	ID int
+}
+
+type User struct {
+	*Base
+	Name       string
+	Tags       []string
+	CreateTime time.Time ` + "`json:\"-\" customjson:\"createTime=$.Unix();time.Unix($, 0)\"`" + `
+	UpdateTime time.Time ` + "`json:\"-\" customjson:\"updateTime=$.Unix();time.Unix($, 0);omitif=$.IsZero()\"`" + `
+}
+
+//encjsongen:marshal $ - 1;$ + 1
+type Count int
+
+func main() {
+	epoch := time.Unix(0, 0)
+	for _, v := range []interface{}{
+		&User{},
+		&User{CreateTime: epoch},
+		&User{CreateTime: epoch, UpdateTime: time.Unix(1, 0)},
+		&User{CreateTime: epoch, Base: &Base{}},
+		&User{CreateTime: epoch, Base: &Base{ID: 1}},
+		&User{CreateTime: epoch, Name: "a"},
+		&User{CreateTime: epoch, Tags: []string{}},
+		new(Count),
+		func() *Count { c := Count(1); return &c }(),
+	} {
+		fmt.Println(v.(interface{ IsZero() bool }).IsZero())
+	}
+}
+`
+	got := run(t, src, Options{Targets: []string{"json", "iszero"}})
+	// time.Time{} is not zero once converted by $.Unix(), but the Unix
+	// epoch is, and UpdateTime omitted is zero.
+	want := `false
+true
+false
+true
+false
+false
+false
+false
+true
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -4,210 +4,569 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"go/ast"
 	"go/token"
-	"go/types"
-	"html/template"
 	"io/ioutil"
+	"os"
 	"path/filepath"
-	"reflect"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/daisuzu/encjsongen/generator"
 	"golang.org/x/tools/go/analysis"
-	"golang.org/x/tools/go/analysis/passes/inspect"
 	"golang.org/x/tools/go/analysis/singlechecker"
-	"golang.org/x/tools/go/ast/inspector"
-	"golang.org/x/tools/imports"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "gen" {
+		os.Exit(gen(os.Args[2:]))
+	}
 	singlechecker.Main(analyzer)
 }
 
 var analyzer = &analysis.Analyzer{
 	Name: "encjsongen",
 	Doc: `Generate MarshalJSON() and UnmarshalJSON() from customjson tag.
+	Other methods are generated with the -target flag.
 	Tag format => customjson:"NAME=EXPR;ASSIGN"
-	    - NAME: Used in place of json tag
+	              customjson:"NAME=EXPR"    (MarshalJSON only)
+	              customjson:"NAME=;ASSIGN" (UnmarshalJSON only)
+	              customjson:"NAME=@PRESET"
+	              customjson:"NAME=EXPR;ASSIGN;default=DEFAULT;validate=COND;omitif=OMIT;import=PATH"
+	    - NAME: Used in place of json tag, optionally followed by ",omitempty",
+	            ",string", which are copied to the alias field, and ",required",
+	            with which UnmarshalJSON fails without the key.
+	            The field name is used if omitted, or converted by -naming.
+	            ",inline" alone flattens the keys of the struct, or the pointer
+	            to one, of EXPR and ASSIGN into the object instead, which
+	            -mode=direct does not support.
 	    - EXPR: Expression to represent alias type(for MarshalJSON)
+	            It may also return (T, error), in which case the error is returned.
+	            It may refer to ctx of MarshalJSONContext(-target=jsonctx), which
+	            is context.Background() in the other methods.
 	    - ASSIGN: Expression to assign to the actual type(for UnmarshalJSON)
+	              It may also return (T, error), in which case the error is returned,
+	              and UnmarshalJSON leaves the field as it is if the key is
+	              missing or null instead of calling it. If more than one ASSIGN of a type does, UnmarshalJSON sets all
+	              the fields and returns the errors of them joined by
+	              errors.Join, each prefixed by the type name and the key, e.g.
+	              "User: invalid createTime: ...".
+	    - DEFAULT: Expression assigned to the field instead of ASSIGN if the key
+	               is missing or null(for UnmarshalJSON)
+	    - COND: Boolean expression of "$" checked after assignment, with which
+	            UnmarshalJSON returns an error if false.
+	    - OMIT: Boolean expression of "$" with which the marshaling methods drop
+	            the key if true, e.g. "$.IsZero()" for time.Time, which omitempty
+	            cannot omit.
+	    - PATH: Space-separated import paths of the packages the expressions of
+	            the type refer to, which the generated file imports as they are
+	            instead of by goimports. They must be imported by any file of
+	            the package. The clauses are optional.
 	Note: "$" in EXPR and ASSIGN is a special character that is converted to
 	      the field name with receiver on the right hand side.
+	      EXPR and ASSIGN wrapped in "[](...)" or "map[](...)" are applied to
+	      each element of a slice or map field, and those wrapped in "*(...)"
+	      are applied to a non-nil pointer field, with "$" being its element.
+	      "$Name" in the expressions is the field Name of the receiver, so that
+	      a key may be computed from several fields, and ASSIGN of the form
+	      "$, $Name = ..." sets the fields listed on the left, "$" being the
+	      field itself, by the values of the right hand side or with an
+	      error, e.g. on First with json:"-":
+	      "fullName=$First + \" \" + $Last;$, $Last = splitName($)"
+	      "func:NAME" as EXPR or ASSIGN calls the function NAME, e.g.
+	      "ts=func:encodeTS;func:decodeTS", which must take a single
+	      parameter of the value and return T or (T, error). NAME, or its
+	      package, must not be a variable of the generated methods, such as
+	      dec, err or aliasCreateTime, which would shadow it.
+	      ";" and "$" in the string and rune literals of the expressions are
+	      kept as they are, e.g. of strings.Split($, ";") and
+	      fmt.Sprintf("US$%d", $), and are escaped as \; and \$ elsewhere, as
+	      "=" is as \=. The quotes and backslashes are escaped in the struct
+	      tag as in any Go string, e.g. customjson:"n=fmt.Sprintf(\"%d\", $)".
+	      "union(NAME:TYPE,...)" in place of EXPR;ASSIGN converts an interface
+	      field holding values of the TYPEs, which are marshaled as objects
+	      with their NAME under the "type" key, and unmarshaled to the TYPE of
+	      the NAME there, e.g. "shape=union(circle:Circle,square:*Square)".
+	      Unexported fields may be converted too, through exported fields of
+	      the generated alias struct.
+	      Exported fields need json:"-" unless NAME is their json key, which
+	      is reported with a suggested fix otherwise.
+	PRESET is a shorthand for a well-known EXPR;ASSIGN pair, which is also
+	applied to each element of a slice, map or pointer field:
+	    - unix:      time.Time as Unix seconds
+	    - unixmilli: time.Time as Unix milliseconds
+	    - rfc3339:   time.Time as RFC 3339 string
+	    - base64:    []byte as standard base64 string
+	    - stringnum: int64 as decimal string
+	    - raw:       []byte as raw JSON, by json.RawMessage
+	    - timestamppb: time.Time as *timestamppb.Timestamp of protobuf
+	    - durationpb:  time.Duration as *durationpb.Duration of protobuf
+	    - bigint:    big.Int as decimal string
+	    - decimal:   decimal.Decimal of shopspring as string
+	    - null:      sql.NullString, NullInt64, NullTime and null.String, Int,
+	                 Time of guregu/null.v4 as their values or null
+	Directive format => //encjsongen:marshal EXPR;ASSIGN
+	                    //encjsongen:strict
+	                    //encjsongen:reset
+	                    //encjsongen:usenumber
+	                    //encjsongen:field FIELD NAME=EXPR;ASSIGN
+	                    //encjsongen:virtual NAME=EXPR
+	                    //encjsongen:import PATH
+	                    //encjsongen:receiver NAME
+	                    //encjsongen:skip
+	                    //encjsongen:oneof
+	                    //encjsongen:enum CONST=NAME ...
+	    - marshal: Put above a named non-struct type to convert the value as a whole.
+	    - strict:  Put above a struct type to make UnmarshalJSON reject unknown keys.
+	    - reset:   Put above a struct type to make UnmarshalJSON and UnmarshalJSONFrom
+	               zero the receiver first, so that the fields of a value reused
+	               across decodes are not left from the previous one when the
+	               keys are missing. null zeroes it too.
+	    - usenumber: Put above a struct type to make UnmarshalJSON decode the
+	                 numbers of interface values, such as of any fields and
+	                 alias types, as json.Number instead of float64, so that
+	                 large integers keep their precision.
+	    - field:   Put above a struct type to convert FIELD as by a customjson tag,
+	               for fields whose tags cannot be modified. NAME equal to the json
+	               key of FIELD replaces the original key.
+	    - virtual: Put above a struct type to marshal the key NAME of no field
+	               from EXPR, in which "$" is the receiver and "$Name" its
+	               field Name, e.g. type="user" or _links=links($ID). It may be
+	               followed by the omitif and import clauses, and UnmarshalJSON
+	               ignores the key, which a strict type cannot have.
+	    - import:  Put above a type to declare PATH as by the import clause.
+	    - receiver: Put above a type to name the receiver of its methods NAME
+	                instead of by -receiver.
+	    - skip:    Put above a type to generate nothing for it whatever its tags,
+	               the Config and -type-map say, e.g. for a hand-written marshaler.
+	    - oneof:   Put above a struct type of pointer fields to generate MarshalJSON
+	               and UnmarshalJSON failing unless exactly one of them is set or
+	               present and not null, which is the only key of the object. The
+	               fields cannot be converted. UnmarshalJSON leaves the value as it
+	               is on null or an error.
+	    - enum:    Put above a named integer type to encode its constants CONST as
+	               the strings NAME, or CONST if "=NAME" is omitted, rejecting the
+	               others. String and ParseTYPE are also generated.
+	Hook => MarshalJSON calls BeforeMarshalJSON() error of the type first, and
+	        UnmarshalJSON calls AfterUnmarshalJSON() error last, if defined.
+	Fix => Unquoted tags, unsupported options, missing json:"-" and directives of
+	       no or tagged fields are reported with suggested fixes, applied by -fix.
+	Gen => "encjsongen gen [-flag] [pattern ...]" takes the same flags and -tags,
+	       loading the packages by go/packages instead of the analysis framework.
 	
 	// Example:
 	type v struct {
-		CreateTime time.Time ` + "`" + `json:"-" customjson:"createTime=$.Unix();time.Unix($, 0)"` + "`" + `
+		CreateTime time.Time   ` + "`" + `json:"-" customjson:"createTime=$.Unix();time.Unix($, 0)"` + "`" + `
+		Times      []time.Time ` + "`" + `json:"-" customjson:"times=[]($.Unix());[](time.Unix($, 0))"` + "`" + `
 	}
+
+	//encjsongen:marshal time.Duration($).String();parseDuration($)
+	type Duration time.Duration
 `,
-	Requires:         []*analysis.Analyzer{inspect.Analyzer},
 	RunDespiteErrors: true,
 	Run:              run,
 }
 
-func run(pass *analysis.Pass) (interface{}, error) {
-	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
-	nodeFilter := []ast.Node{
-		(*ast.TypeSpec)(nil),
-	}
-	inspect.Preorder(nodeFilter, func(n ast.Node) {
-		ts := n.(*ast.TypeSpec)
-
-		s, ok := ts.Type.(*ast.StructType)
-		if !ok {
-			return
-		}
+var (
+	output     string // -output flag
+	suffix     string // -suffix flag
+	tagName    string // -tag flag
+	local      string // -local flag
+	gofumpt    bool   // -gofumpt flag
+	singleFile string // -single-file flag
+	buildTags  string // -buildtags flag
+	dryRun     bool   // -dry-run flag
+	check      bool   // -check flag
+	force      bool   // -force flag
+	clean      bool   // -clean flag
+	verbose    bool   // -verbose flag
+	toStdout   bool   // -stdout flag
+	headerFile string // -header-file flag
+	jsonPkg    string // -json-pkg flag
+	targetList string // -target flag
+	bsonPkg    string // -bson-pkg flag
+	msgpackPkg string // -msgpack-pkg flag
+	genTests   bool   // -gen-tests flag
+	genBench   bool   // -gen-benchmarks flag
+	genFuzz    bool   // -gen-fuzz flag
+	schemaOut  string // -schema-out flag
+	openapiOut string // -openapi-out flag
+	tsOut      string // -ts-out flag
+	strict     bool   // -strict flag
+	useNumber  bool   // -use-number flag
+	mode       string // -mode flag
+	naming     string // -naming flag
+	receiver   string // -receiver flag
+	valueRecv  bool   // -value-receiver flag
+	pool       bool   // -pool flag
+	procs      int    // -p flag
+	cacheFile  string // -cache flag
+	configFile string // -config flag
+	tmplDir    string // -template-dir flag
+)
 
-		si := newStructInfo(pass.Fset, pass.Pkg, ts)
-		for _, f := range s.Fields.List {
-			if f.Tag == nil {
-				continue
-			}
-			customjson := reflect.StructTag(f.Tag.Value).Get("customjson")
-			if customjson == "" {
-				continue
-			}
-			if err := si.AddAlias(f.Names[0].Name, customjson); err != nil {
-				pass.Reportf(f.Pos(), "%v", err)
-				return
-			}
-		}
-		if si.HasAlias() {
-			if err := si.Output(); err != nil {
-				pass.Reportf(ts.Pos(), "failed to generate: %v", err)
-			}
-		}
-	})
+var typeMap = make(typeMapFlag) // -type-map flag
 
-	return nil, nil
+func init() {
+	analyzer.Flags.StringVar(&output, "output", "",
+		`path of the generated file, in which "{name}" is replaced by the lower-cased type name; relative to the package directory (default "{name}" followed by -suffix)`)
+	analyzer.Flags.StringVar(&suffix, "suffix", "",
+		`suffix of the generated files following the lower-cased type names, e.g. "_gen.go" or ".encjson.go"; exclusive with -output (default "_json.go")`)
+	analyzer.Flags.StringVar(&tagName, "tag", "customjson",
+		`key of the struct tags read instead of customjson, e.g. myjson for myjson:"NAME=EXPR;ASSIGN"`)
+	analyzer.Flags.StringVar(&singleFile, "single-file", "",
+		"if set, generate all methods of a package into this file instead; relative to the package directory")
+	analyzer.Flags.StringVar(&buildTags, "buildtags", "",
+		"build constraint added to the generated files, in addition to that of the source file (e.g. !tinygo)")
+	analyzer.Flags.BoolVar(&dryRun, "dry-run", false,
+		"print a unified diff of the generated files instead of writing them")
+	analyzer.Flags.BoolVar(&check, "check", false,
+		"report generated files which are out of date instead of writing them")
+	analyzer.Flags.BoolVar(&force, "force", false,
+		`overwrite existing files lacking the "Code generated by encjsongen" header, which are otherwise reported as hand-written`)
+	analyzer.Flags.BoolVar(&clean, "clean", false,
+		"remove the files generated by encjsongen in the package directories which are no longer generated, e.g. of renamed types; -cache is ignored")
+	analyzer.Flags.BoolVar(&verbose, "verbose", false,
+		"log the types found and the files written, unchanged or removed to stderr, with the time taken by each package and the totals of the run")
+	analyzer.Flags.BoolVar(&toStdout, "stdout", false,
+		`write the generated files to stdout in txtar format ("-- filename --" followed by the content) instead`)
+	analyzer.Flags.StringVar(&headerFile, "header-file", "",
+		`file whose content, such as a license comment, is prepended to the "Code generated" line of the generated files`)
+	analyzer.Flags.StringVar(&local, "local", "",
+		"comma-separated import path prefixes whose imports are grouped after the others in the generated files, as with goimports -local")
+	analyzer.Flags.BoolVar(&gofumpt, "gofumpt", false,
+		"format the generated files by gofumpt, which is stricter than gofmt")
+	analyzer.Flags.StringVar(&jsonPkg, "json-pkg", "encoding/json",
+		"import path of the package providing Marshal and Unmarshal compatible with encoding/json (e.g. github.com/goccy/go-json)")
+	analyzer.Flags.StringVar(&targetList, "target", "json",
+		"comma-separated list of methods to generate: "+strings.Join(generator.Targets(), ", "))
+	analyzer.Flags.StringVar(&bsonPkg, "bson-pkg", "go.mongodb.org/mongo-driver/v2/bson",
+		"import path of the bson package for -target=bson")
+	analyzer.Flags.StringVar(&msgpackPkg, "msgpack-pkg", "github.com/vmihailenco/msgpack/v5",
+		"import path of the msgpack package for -target=msgpack")
+	analyzer.Flags.BoolVar(&genTests, "gen-tests", false,
+		`generate round-trip tests of MarshalJSON and UnmarshalJSON into "_test.go" files next to the generated files`)
+	analyzer.Flags.BoolVar(&genBench, "gen-benchmarks", false,
+		`generate benchmarks of MarshalJSON and UnmarshalJSON into "_test.go" files next to the generated files`)
+	analyzer.Flags.BoolVar(&genFuzz, "gen-fuzz", false,
+		`generate fuzz tests of UnmarshalJSON into "_test.go" files next to the generated files`)
+	analyzer.Flags.StringVar(&schemaOut, "schema-out", "",
+		`if set, path of the JSON Schema file written for each struct type, in which "{name}" is replaced by the lower-cased type name; relative to the package directory`)
+	analyzer.Flags.StringVar(&openapiOut, "openapi-out", "",
+		"if set, path of the file written with the OpenAPI component schemas of the converted types of each package; relative to the package directory")
+	analyzer.Flags.StringVar(&tsOut, "ts-out", "",
+		"if set, path of the TypeScript declaration file written for the converted types of each package (e.g. types.d.ts); relative to the package directory")
+	analyzer.Flags.BoolVar(&strict, "strict", false,
+		"make UnmarshalJSON of all struct types reject unknown keys, as with the encjsongen:strict directive")
+	analyzer.Flags.BoolVar(&useNumber, "use-number", false,
+		"make UnmarshalJSON of all struct types decode the numbers of interface values as json.Number, as with the encjsongen:usenumber directive")
+	analyzer.Flags.StringVar(&mode, "mode", "reflect",
+		`how the json target encodes: "reflect" by json.Marshal and json.Unmarshal of an alias struct, or "direct" field by field`)
+	analyzer.Flags.StringVar(&naming, "naming", "",
+		`JSON keys derived from the field names for the customjson tags omitting NAME: "snake", "camel" or "kebab" (default the field names)`)
+	analyzer.Flags.StringVar(&receiver, "receiver", "v",
+		`receiver of the generated methods, in which "{initial}" is replaced by the lower-cased first letter of the type name, as with the encjsongen:receiver directive`)
+	analyzer.Flags.BoolVar(&valueRecv, "value-receiver", false,
+		"generate the marshaling methods, such as MarshalJSON, on value receivers, so that values stored in maps and slices or of interfaces are converted too; the unmarshaling methods keep pointer receivers")
+	analyzer.Flags.BoolVar(&pool, "pool", false,
+		"make MarshalJSON of -mode=direct take the buffers from a pool shared by the generated methods")
+	analyzer.Flags.IntVar(&procs, "p", runtime.GOMAXPROCS(0),
+		"number of packages, and of files of each of them, generated in parallel")
+	analyzer.Flags.StringVar(&configFile, "config", "",
+		"path of the configuration file of conversion rules (default encjsongen.yaml at the module root of each package, if any)")
+	analyzer.Flags.Var(typeMap, "type-map",
+		`TYPE=EXPR;ASSIGN or TYPE=@PRESET converting every field of TYPE (e.g. time.Time or example.com/pkg.T) under its json key; may be repeated`)
+	analyzer.Flags.StringVar(&tmplDir, "template-dir", "",
+		"if set, directory of MarshalJSON.tmpl and UnmarshalJSON.tmpl replacing the templates of -target=json for struct types")
+	analyzer.Flags.StringVar(&cacheFile, "cache", "",
+		"if set, file caching the hashes of the type declarations of the generated files, which are not generated again while unchanged")
 }
 
-type alias struct {
-	Target  string
-	JSONKey string
-	Type    string
-	Expr    string
-	Assign  string
+// typeMapFlag is the value of the -type-map flag, mapping types to their
+// conversions.
+type typeMapFlag map[string]string
+
+func (m typeMapFlag) String() string {
+	var pairs []string
+	for typ, conv := range m {
+		pairs = append(pairs, typ+"="+conv)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
 }
 
-func newStructInfo(fset *token.FileSet, pkg *types.Package, ts *ast.TypeSpec) *structInfo {
-	return &structInfo{
-		fset:     fset,
-		pkg:      pkg,
-		path:     filepath.Dir(fset.File(ts.Pos()).Name()),
-		Receiver: ts.Name.Name,
+func (m typeMapFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return fmt.Errorf("%q must be TYPE=EXPR;ASSIGN or TYPE=@PRESET", s)
 	}
+	m[s[:i]] = s[i+1:]
+	return nil
 }
 
-type structInfo struct {
-	fset *token.FileSet
-	pkg  *types.Package
-	path string
+// packageSem limits the packages generated in parallel, which are
+// analyzed by as many goroutines as the checker runs.
+var (
+	packageSem     chan struct{}
+	packageSemOnce sync.Once
+)
 
-	Receiver string
-	Aliases  []alias
+func run(pass *analysis.Pass) (interface{}, error) {
+	pkg := &generator.Package{
+		Fset:      pass.Fset,
+		Types:     pass.Pkg,
+		TypesInfo: pass.TypesInfo,
+		Syntax:    pass.Files,
+	}
+	g, err := packageGenerator(pkg)
+	if err != nil {
+		return nil, err
+	}
+	generatePackage(g, pkg, func(d generator.Diagnostic) {
+		pass.Report(analysisDiagnostic(d))
+	})
+	// The analysis driver exits without telling when the last package is
+	// done, so the totals so far are logged after each, the last of which
+	// is the summary of the run.
+	logSummary(time.Since(processStart))
+	return nil, nil
 }
 
-func (si *structInfo) AddAlias(name, tag string) error {
-	i := strings.Index(tag, "=")
-	if i < 1 {
-		return errors.New("invalid tag")
+// analysisDiagnostic returns d with its fix as a suggested fix.
+func analysisDiagnostic(d generator.Diagnostic) analysis.Diagnostic {
+	ad := analysis.Diagnostic{Pos: d.Pos, End: d.End, Message: d.Message}
+	if d.Fix != nil {
+		fix := analysis.SuggestedFix{Message: d.Fix.Message}
+		for _, e := range d.Fix.Edits {
+			fix.TextEdits = append(fix.TextEdits, analysis.TextEdit{Pos: e.Pos, End: e.End, NewText: e.NewText})
+		}
+		ad.SuggestedFixes = []analysis.SuggestedFix{fix}
 	}
+	return ad
+}
 
-	exprs := strings.Split(tag[i+1:], ";")
-	if len(exprs) != 2 {
-		return errors.New("invalid tag")
+// newGenerator returns the generator configured by the flags and cfg.
+func newGenerator(cfg *generator.Config) (*generator.Generator, error) {
+	if procs < 1 {
+		return nil, errors.New("-p must be positive")
 	}
-
-	typ, err := types.Eval(si.fset, si.pkg, 0, strings.Replace(exprs[0], "$", si.Receiver+"{}."+name, -1))
-	if err != nil {
-		return err
+	opts := generator.Options{
+		Output:        output,
+		Suffix:        suffix,
+		Tag:           tagName,
+		LocalPrefix:   local,
+		Gofumpt:       gofumpt,
+		SingleFile:    singleFile,
+		BuildTags:     buildTags,
+		JSONPkg:       jsonPkg,
+		Targets:       strings.Split(targetList, ","),
+		BSONPkg:       bsonPkg,
+		MsgpackPkg:    msgpackPkg,
+		GenTests:      genTests,
+		GenBenchmarks: genBench,
+		GenFuzz:       genFuzz,
+		SchemaOut:     schemaOut,
+		OpenAPIOut:    openapiOut,
+		TSOut:         tsOut,
+		Strict:        strict,
+		UseNumber:     useNumber,
+		Mode:          mode,
+		Naming:        naming,
+		Receiver:      receiver,
+		ValueReceiver: valueRecv,
+		Pool:          pool,
+		Procs:         procs,
+		Config:        cfg,
+		TypeMap:       typeMap,
 	}
-	if typ.Type == nil {
-		return errors.New("invalid expr")
+	if headerFile != "" {
+		header, err := ioutil.ReadFile(headerFile)
+		if err != nil {
+			return nil, err
+		}
+		opts.Header = header
 	}
-
-	si.Aliases = append(si.Aliases, alias{
-		Target:  name,
-		JSONKey: tag[:i],
-		Type:    typ.Type.String(),
-		Expr:    strings.Replace(exprs[0], "$", "v."+name, -1),
-		Assign:  strings.Replace(exprs[1], "$", "aux.Alias"+name, -1),
-	})
-	return nil
+	if tmplDir != "" {
+		tmpls, err := readTemplates(tmplDir)
+		if err != nil {
+			return nil, err
+		}
+		opts.Templates = tmpls
+	}
+	if useCache() {
+		opts.Unchanged = cached
+	}
+	if verbose {
+		opts.Found = found
+	}
+	return generator.New(opts)
 }
 
-func (si *structInfo) HasAlias() bool {
-	return len(si.Aliases) > 0
+// readTemplates returns the contents of the template files in dir by the
+// names of Options.Templates, of which at least one must exist.
+func readTemplates(dir string) (map[string]string, error) {
+	tmpls := make(map[string]string)
+	for _, name := range []string{"MarshalJSON", "UnmarshalJSON"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name+".tmpl"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tmpls[name] = string(b)
+	}
+	if len(tmpls) == 0 {
+		return nil, fmt.Errorf("-template-dir: neither MarshalJSON.tmpl nor UnmarshalJSON.tmpl in %s", dir)
+	}
+	return tmpls, nil
 }
 
-func (si *structInfo) Output() error {
-	b := new(bytes.Buffer)
-	fmt.Fprintf(b, "// Code generated by encjsongen. DO NOT EDIT.\n\n")
-	fmt.Fprintf(b, "package %s\n\n", si.pkg.Name())
-	if err := template.Must(template.New("marshal").Parse(tmplMarshalJSON)).Execute(b, si); err != nil {
-		return err
+// generatePackage generates the files of pkg by g and emits them,
+// reporting the problems by report.
+func generatePackage(g *generator.Generator, pkg *generator.Package, report func(d generator.Diagnostic)) {
+	packageSemOnce.Do(func() {
+		packageSem = make(chan struct{}, procs)
+	})
+	packageSem <- struct{}{}
+	defer func() { <-packageSem }()
+	start := time.Now()
+	defer func() {
+		logf("%s: done in %v", pkg.Types.Path(), time.Since(start).Round(time.Millisecond))
+		count(&totals.packages)
+	}()
+
+	files, diags := g.Package(pkg)
+	for _, d := range diags {
+		report(d)
 	}
-	fmt.Fprintf(b, "\n")
-	if err := template.Must(template.New("unmarshal").Parse(tmplUnmarshalJSON)).Execute(b, si); err != nil {
-		return err
+	failed := false
+	for _, f := range files {
+		if err := emit(f.Name, f.Content); err != nil {
+			reportError(report, f.Pos, err)
+			failed = true
+		}
 	}
-
-	filename := filepath.Join(si.path, strings.ToLower(si.Receiver)+"_json.go")
-	src, err := imports.Process(filename, b.Bytes(), nil)
-	if err != nil {
-		return err
+	if failed {
+		return
+	}
+	if clean && len(diags) == 0 && len(pkg.Syntax) > 0 {
+		generated := make(map[string]bool)
+		for _, f := range files {
+			generated[f.Name] = true
+		}
+		pos := pkg.Syntax[0].Pos()
+		filenames, err := orphans(pkg.FileDir(pos), pkg.Types.Name(), generated)
+		if err != nil {
+			reportError(report, pos, err)
+		}
+		for _, filename := range filenames {
+			if err := remove(filename); err != nil {
+				reportError(report, filePos(pkg, filename, pos), err)
+			}
+		}
+	}
+	for _, f := range files {
+		if f.Hash == "" {
+			continue
+		}
+		if err := storeCache(f.Name, f.Hash); err != nil {
+			reportError(report, f.Pos, err)
+		}
 	}
-	return ioutil.WriteFile(filename, src, 0644)
 }
 
-func (si *structInfo) Exprs() []string {
-	exprs := make([]string, len(si.Aliases))
-	for i, a := range si.Aliases {
-		exprs[i] = fmt.Sprintf("Alias%s: %s,", a.Target, a.Expr)
+// filePos returns the position of the file filename of pkg, or def if it
+// is not loaded, e.g. excluded by the build constraints.
+func filePos(pkg *generator.Package, filename string, def token.Pos) token.Pos {
+	for _, f := range pkg.Syntax {
+		if pkg.Fset.File(f.Pos()).Name() == filename {
+			return f.Pos()
+		}
 	}
-	return exprs
+	return def
 }
 
-func (si *structInfo) Assigns() []string {
-	exprs := make([]string, len(si.Aliases))
-	for i, a := range si.Aliases {
-		exprs[i] = fmt.Sprintf("v.%s = %s", a.Target, a.Assign)
+// staleError is returned by -check for a file which is out of date.
+type staleError struct {
+	filename string
+}
+
+func (e *staleError) Error() string {
+	return e.filename + " is out of date"
+}
+
+func reportError(report func(d generator.Diagnostic), pos token.Pos, err error) {
+	switch err.(type) {
+	case *staleError, *orphanedError:
+		report(generator.Diagnostic{Pos: pos, Message: err.Error()})
+		return
 	}
-	return exprs
+	report(generator.Diagnostic{Pos: pos, Message: "failed to generate: " + err.Error()})
 }
 
-const tmplMarshalJSON = `func (v *{{.Receiver}}) MarshalJSON() ([]byte, error) {
-	type Alias {{.Receiver}}
-	return json.Marshal(&struct {
-		*Alias
-		{{- range .Aliases }}
-		Alias{{.Target}} {{.Type}} ` + "`json:" + `"{{.JSONKey}}"` + "`" + `
-		{{- end }}
-	}{
-		Alias: (*Alias)(v),
-		{{- range .Exprs }}
-		{{.}}
-		{{- end }}
-	})
+// handWritten reports whether old, the content of the file to be replaced
+// by src, lacks the header of the generated files which src has. Files
+// without the header, such as JSON Schemas, cannot be told.
+func handWritten(old, src []byte) bool {
+	marker := []byte(generator.GeneratedMarker)
+	return bytes.Contains(src, marker) && !bytes.Contains(old, marker)
 }
-`
 
-const tmplUnmarshalJSON = `func (v *{{.Receiver}}) UnmarshalJSON(b []byte) error {
-	type Alias {{.Receiver}}
-	aux := &struct {
-		*Alias
-		{{- range .Aliases }}
-		Alias{{.Target}} {{.Type}} ` + "`json:" + `"{{.JSONKey}}"` + "`" + `
-		{{- end }}
-	}{
-		Alias: (*Alias)(v),
+// stdoutMu serializes output of packages analyzed in parallel.
+var stdoutMu sync.Mutex
+
+// emit writes src to filename or stdout, or compares it with the existing
+// file with -dry-run or -check.
+func emit(filename string, src []byte) error {
+	if toStdout {
+		stdoutMu.Lock()
+		defer stdoutMu.Unlock()
+		if _, err := fmt.Fprintf(os.Stdout, "-- %s --\n", filename); err != nil {
+			return err
+		}
+		_, err := os.Stdout.Write(src)
+		return err
+	}
+	if dryRun || check {
+		old, err := ioutil.ReadFile(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if dryRun {
+			stdoutMu.Lock()
+			_, err = os.Stdout.Write(unifiedDiff(filename, old, src))
+			stdoutMu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+		if check && (old == nil || !bytes.Equal(old, src)) {
+			return &staleError{filename}
+		}
+		return nil
+	}
+
+	if old, err := ioutil.ReadFile(filename); err == nil {
+		if bytes.Equal(old, src) {
+			// The modification time is kept for build systems.
+			logf("unchanged %s", filename)
+			count(&totals.unchanged)
+			return nil
+		}
+		if !force && handWritten(old, src) {
+			return fmt.Errorf("%s is not generated by encjsongen; remove it or use -force to overwrite it", filename)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
 	}
-	if err := json.Unmarshal(b, &aux); err != nil {
+	if err := ioutil.WriteFile(filename, src, 0644); err != nil {
 		return err
 	}
-	{{- range .Assigns }}
-	{{.}}
-	{{- end }}
+	logf("wrote %s", filename)
+	count(&totals.written)
 	return nil
 }
-`
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"go/token"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// logger writes the progress of -verbose.
+var logger = log.New(os.Stderr, "encjsongen: ", 0)
+
+// processStart is the time the process started, from which the analyzer
+// measures the run.
+var processStart = time.Now()
+
+// totals counts the work of all the packages, summarized by -verbose.
+var totals struct {
+	sync.Mutex
+	packages, types, written, unchanged, removed int
+}
+
+// logf logs the progress with -verbose.
+func logf(format string, args ...interface{}) {
+	if verbose {
+		logger.Printf(format, args...)
+	}
+}
+
+// count adds 1 to the total n, which is of totals.
+func count(n *int) {
+	totals.Lock()
+	defer totals.Unlock()
+	*n++
+}
+
+// found is Options.Found with -verbose.
+func found(pos token.Position, name string) {
+	logf("%s: found %s", pos, name)
+	count(&totals.types)
+}
+
+// logSummary logs the totals of the run which took elapsed.
+func logSummary(elapsed time.Duration) {
+	totals.Lock()
+	defer totals.Unlock()
+	logf("%d packages, %d types, %d files written, %d unchanged, %d removed in %v",
+		totals.packages, totals.types, totals.written, totals.unchanged, totals.removed, elapsed.Round(time.Millisecond))
+}